@@ -0,0 +1,487 @@
+// Package config 按 id、default、desc 标签从配置文件、环境变量与命令行参数加载配置.
+//
+// 字段名依次取 id 标签、json 标签、小写字段名, id 或 json 为 "-" 时忽略.
+// 嵌套结构体按层级组织, 如:
+//
+//	type Config struct {
+//	    DB   db.RWOptions `id:"db"`
+//	    GRPC grpc.Options `id:"rpc"`
+//	}
+//
+// 对应配置文件 db.write.mysql_host, 环境变量 <EnvPrefix>_DB_WRITE_MYSQL_HOST, 命令行参数 -db.write.mysql_host.
+//
+// 优先级: 命令行参数 > 环境变量 > 配置文件 > default 标签.
+// default 只填充未配置且为零值的字段, 指针结构体仅在已存在或有配置时创建.
+// time.Duration 使用 30s、1m 形式的字符串, 数字为纳秒. 切片在环境变量与命令行参数中以逗号分隔.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidTarget     = errors.New("config: target must be a non-nil pointer to struct")
+	ErrUnsupportedFormat = errors.New("config: unsupported file format")
+	// 配置项对应的命令行参数已在 FlagSet 中定义, 如重复 Load 或与业务参数同名.
+	ErrFlagRedefined = errors.New("config: flag already defined")
+)
+
+// UnknownKeysError 配置文件包含未定义的配置项, 其余配置项已正常加载.
+type UnknownKeysError struct {
+	Keys []string
+}
+
+func (e *UnknownKeysError) Error() string {
+	return "config: unknown keys: " + strings.Join(e.Keys, ", ")
+}
+
+// Options 加载配置.
+type Options struct {
+	// 配置文件, 按扩展名识别 .yml、.yaml、.json、.toml, 后者覆盖前者.
+	Files []string
+	// 是否读取环境变量.
+	Env bool
+	// 环境变量前缀, 如 APP 对应 APP_DB_WRITE_MYSQL_HOST.
+	EnvPrefix string
+	// 命令行参数, 通常为 os.Args[1:], 为 nil 不解析.
+	Args []string
+	// 注册参数的 FlagSet, 可与业务参数共用. 为 nil 创建新的 FlagSet.
+	// 参数已定义时返回 ErrFlagRedefined, 同一 FlagSet 不能重复 Load.
+	FlagSet *flag.FlagSet
+}
+
+// field 叶子配置项.
+type field struct {
+	// 点分隔路径.
+	key string
+	// 从根结构体到字段的索引.
+	index  [][]int
+	def    string
+	hasDef bool
+	desc   string
+	typ    reflect.Type
+}
+
+// Load 加载配置到 dst.
+//
+// 配置文件存在未定义的配置项时返回 *UnknownKeysError.
+func Load(dst interface{}, opts Options) error {
+	root, err := target(dst)
+	if err != nil {
+		return err
+	}
+	fields := collect(root.Type(), nil, nil)
+	byKey := make(map[string]*field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+	set := make(map[string]bool)
+
+	var unknown []string
+	for _, path := range opts.Files {
+		values, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		for key, v := range flatten(values, "") {
+			f, ok := byKey[key]
+			if !ok {
+				// 空的结构体配置, 如 yaml 中只有 grpc:
+				if v != nil || !hasPrefix(fields, key+".") {
+					unknown = append(unknown, key)
+				}
+				continue
+			}
+			if err := assign(root, f, v); err != nil {
+				return fmt.Errorf("config: %s: %s: %w", path, key, err)
+			}
+			set[key] = true
+		}
+	}
+
+	if opts.Env {
+		for _, f := range fields {
+			name := envName(opts.EnvPrefix, f.key)
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := assign(root, f, v); err != nil {
+				return fmt.Errorf("config: env %s: %w", name, err)
+			}
+			set[f.key] = true
+		}
+	}
+
+	if opts.Args != nil {
+		fs := opts.FlagSet
+		if fs == nil {
+			fs = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+		}
+		for _, f := range fields {
+			if fs.Lookup(f.key) != nil {
+				return fmt.Errorf("%w: -%s", ErrFlagRedefined, f.key)
+			}
+		}
+		values := make(map[string]*flagValue, len(fields))
+		for _, f := range fields {
+			fv := &flagValue{def: f.def, isBool: f.typ.Kind() == reflect.Bool}
+			values[f.key] = fv
+			fs.Var(fv, f.key, f.desc)
+		}
+		if err := fs.Parse(opts.Args); err != nil {
+			return err
+		}
+		var flagErr error
+		fs.Visit(func(fl *flag.Flag) {
+			fv, ok := values[fl.Name]
+			if !ok || flagErr != nil {
+				return
+			}
+			if err := assign(root, byKey[fl.Name], fv.value); err != nil {
+				flagErr = fmt.Errorf("config: flag -%s: %w", fl.Name, err)
+			}
+			set[fl.Name] = true
+		})
+		if flagErr != nil {
+			return flagErr
+		}
+	}
+
+	if err := applyDefaults(root, fields, set); err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return &UnknownKeysError{Keys: unknown}
+	}
+	return nil
+}
+
+// Defaults 按 default 标签填充零值字段, 不创建为 nil 的指针结构体.
+func Defaults(dst interface{}) error {
+	root, err := target(dst)
+	if err != nil {
+		return err
+	}
+	return applyDefaults(root, collect(root.Type(), nil, nil), nil)
+}
+
+func target(dst interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, ErrInvalidTarget
+	}
+	return rv.Elem(), nil
+}
+
+func applyDefaults(root reflect.Value, fields []*field, set map[string]bool) error {
+	for _, f := range fields {
+		if !f.hasDef || set[f.key] {
+			continue
+		}
+		v, ok := lookup(root, f)
+		if !ok || !v.IsZero() {
+			continue
+		}
+		if err := assign(root, f, f.def); err != nil {
+			return fmt.Errorf("config: default of %s: %w", f.key, err)
+		}
+	}
+	return nil
+}
+
+// collect 收集结构体的叶子配置项.
+func collect(t reflect.Type, prefix []string, index [][]int) []*field {
+	var fields []*field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		path := append(append([]string(nil), prefix...), name)
+		idx := append(append([][]int(nil), index...), sf.Index)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && ft != reflect.TypeOf(&time.Time{}) {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			// 未命名的嵌入结构体展开到当前层级
+			if sf.Anonymous && sf.Tag.Get("id") == "" && sf.Tag.Get("json") == "" {
+				path = prefix
+			}
+			fields = append(fields, collect(ft, path, idx)...)
+			continue
+		}
+		if !supported(sf.Type) {
+			continue
+		}
+		def, hasDef := sf.Tag.Lookup("default")
+		fields = append(fields, &field{
+			key:    strings.Join(path, "."),
+			index:  idx,
+			def:    def,
+			hasDef: hasDef,
+			desc:   sf.Tag.Get("desc"),
+			typ:    sf.Type,
+		})
+	}
+	return fields
+}
+
+func fieldName(sf reflect.StructField) string {
+	if id := sf.Tag.Get("id"); id != "" {
+		return id
+	}
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(sf.Name)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && supported(t.Elem())
+	case reflect.Struct:
+		return t == reflect.TypeOf(time.Time{})
+	}
+	return false
+}
+
+// lookup 返回字段值, 路径上存在 nil 指针时返回 false.
+func lookup(root reflect.Value, f *field) (reflect.Value, bool) {
+	v := root
+	for i, idx := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(idx)
+	}
+	return v, true
+}
+
+// assign 按需创建路径上的指针结构体并赋值.
+func assign(root reflect.Value, f *field, raw interface{}) error {
+	v := root
+	for i, idx := range f.index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByIndex(idx)
+	}
+	return convert(v, raw)
+}
+
+// convert 转换配置值, 字符串按字段类型解析, 切片支持逗号分隔.
+func convert(v reflect.Value, raw interface{}) error {
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Slice {
+		var items []interface{}
+		switch r := raw.(type) {
+		case []interface{}:
+			items = r
+		case string:
+			for _, s := range strings.Split(r, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					items = append(items, s)
+				}
+			}
+		default:
+			items = []interface{}{r}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := convert(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	s, isString := raw.(string)
+	switch {
+	case v.Type() == durationType:
+		if isString {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+	case v.Type() == reflect.TypeOf(time.Time{}):
+		if t, ok := raw.(time.Time); ok {
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, fmt.Sprint(raw))
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if !isString {
+		s = fmt.Sprint(raw)
+		if f, ok := raw.(float64); ok {
+			s = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// readFile 读取配置文件为嵌套 map.
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten 展开嵌套 map 为点分隔路径.
+func flatten(values map[string]interface{}, prefix string) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for k, v := range values {
+		key := prefix + k
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			for fk, fv := range flatten(vv, key+".") {
+				flat[fk] = fv
+			}
+		case []map[string]interface{}:
+			// TOML 表数组
+			items := make([]interface{}, len(vv))
+			for i, item := range vv {
+				items[i] = item
+			}
+			flat[key] = items
+		default:
+			flat[key] = v
+		}
+	}
+	return flat
+}
+
+func hasPrefix(fields []*field, prefix string) bool {
+	for _, f := range fields {
+		if strings.HasPrefix(f.key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func envName(prefix, key string) string {
+	name := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// flagValue 记录命令行参数原始值, 解析后统一赋值.
+type flagValue struct {
+	def    string
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Name  string     `id:"name" default:"app"`
+	DB    testDB     `id:"db"`
+	Cache *testCache `id:"cache"`
+	Tags  []string   `id:"tags"`
+}
+
+type testDB struct {
+	Host    string        `id:"host" default:"localhost"`
+	Port    int           `id:"port" default:"3306"`
+	Timeout time.Duration `id:"timeout" default:"5s"`
+}
+
+type testCache struct {
+	Addr string `id:"addr" default:":6379"`
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := "name: file\ndb:\n  host: file-host\n  port: 3307\n"
+	tests := []struct {
+		name  string
+		files [][2]string
+		env   map[string]string
+		args  []string
+		want  testConfig
+	}{
+		{
+			name: "defaults",
+			want: testConfig{Name: "app", DB: testDB{Host: "localhost", Port: 3306, Timeout: 5 * time.Second}},
+		},
+		{
+			name:  "file over defaults",
+			files: [][2]string{{"app.yaml", yamlFile}},
+			want:  testConfig{Name: "file", DB: testDB{Host: "file-host", Port: 3307, Timeout: 5 * time.Second}},
+		},
+		{
+			name:  "later file over earlier",
+			files: [][2]string{{"app.yaml", yamlFile}, {"app.json", `{"db": {"port": 3308, "timeout": "1m"}}`}},
+			want:  testConfig{Name: "file", DB: testDB{Host: "file-host", Port: 3308, Timeout: time.Minute}},
+		},
+		{
+			name:  "env over file",
+			files: [][2]string{{"app.yaml", yamlFile}},
+			env:   map[string]string{"APP_DB_HOST": "env-host", "APP_TAGS": "a, b"},
+			want:  testConfig{Name: "file", DB: testDB{Host: "env-host", Port: 3307, Timeout: 5 * time.Second}, Tags: []string{"a", "b"}},
+		},
+		{
+			name:  "flag over env",
+			files: [][2]string{{"app.yaml", yamlFile}},
+			env:   map[string]string{"APP_DB_HOST": "env-host", "APP_NAME": "env"},
+			args:  []string{"-db.host", "flag-host", "-cache.addr", ":6380"},
+			want:  testConfig{Name: "env", DB: testDB{Host: "flag-host", Port: 3307, Timeout: 5 * time.Second}, Cache: &testCache{Addr: ":6380"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, file := range tt.files {
+				files = append(files, writeFile(t, file[0], file[1]))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if args == nil {
+				args = []string{}
+			}
+
+			var got testConfig
+			err := Load(&got, Options{
+				Files:     files,
+				Env:       true,
+				EnvPrefix: "APP",
+				Args:      args,
+				FlagSet:   flag.NewFlagSet("test", flag.ContinueOnError),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPointerDefaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   testConfig
+		files [][2]string
+		want  *testCache
+	}{
+		{name: "nil pointer stays nil"},
+		{name: "existing pointer filled", cfg: testConfig{Cache: &testCache{}}, want: &testCache{Addr: ":6379"}},
+		{name: "configured pointer created", files: [][2]string{{"app.toml", "[cache]\naddr = \":7000\"\n"}}, want: &testCache{Addr: ":7000"}},
+		{name: "empty section keeps defaults", files: [][2]string{{"app.yaml", "cache:\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, file := range tt.files {
+				files = append(files, writeFile(t, file[0], file[1]))
+			}
+			cfg := tt.cfg
+			if err := Load(&cfg, Options{Files: files}); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Cache, tt.want) {
+				t.Fatalf("cache %+v, want %+v", cfg.Cache, tt.want)
+			}
+			if cfg.DB.Port != 3306 {
+				t.Fatalf("db.port %d, want default 3306", cfg.DB.Port)
+			}
+		})
+	}
+}
+
+func TestLoadUnknownKeys(t *testing.T) {
+	path := writeFile(t, "app.yaml", "name: file\ndb:\n  hots: x\n  port: 3307\nextra: 1\n")
+
+	var cfg testConfig
+	err := Load(&cfg, Options{Files: []string{path}})
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("got %v, want UnknownKeysError", err)
+	}
+	if want := []string{"db.hots", "extra"}; !reflect.DeepEqual(unknown.Keys, want) {
+		t.Fatalf("keys %v, want %v", unknown.Keys, want)
+	}
+	// 其余配置项已加载.
+	if cfg.Name != "file" || cfg.DB.Port != 3307 || cfg.DB.Host != "localhost" {
+		t.Fatalf("got %+v", cfg)
+	}
+}
+
+func TestLoadFlagRedefined(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var cfg testConfig
+	if err := Load(&cfg, Options{Args: []string{}, FlagSet: fs}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(&cfg, Options{Args: []string{}, FlagSet: fs}); !errors.Is(err, ErrFlagRedefined) {
+		t.Fatalf("second load: got %v, want ErrFlagRedefined", err)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("name", "", "business flag")
+	if err := Load(&cfg, Options{Args: []string{}, FlagSet: fs}); !errors.Is(err, ErrFlagRedefined) {
+		t.Fatalf("shared name: got %v, want ErrFlagRedefined", err)
+	}
+}
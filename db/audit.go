@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+)
+
+const auditPluginName = "driver:audit"
+
+var ErrAuditRequiresTransaction = errors.New("audited change requires transaction")
+
+// 审计操作.
+const (
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord 审计记录, 每个变更行一条.
+//
+// 可通过 AutoMigrate 或迁移脚本创建审计表.
+type AuditRecord struct {
+	ID        int64           `gorm:"primaryKey"`
+	Table     string          `gorm:"size:64;index:idx_audit_row"`
+	RowID     string          `gorm:"size:191;index:idx_audit_row"`
+	Operation string          `gorm:"size:16"`
+	Actor     string          `gorm:"size:128"`
+	Before    json.RawMessage `gorm:"type:json"`
+	After     json.RawMessage `gorm:"type:json"` // 删除为 NULL
+	CreatedAt time.Time       `gorm:"index"`
+}
+
+// AuditOptions 审计配置.
+type AuditOptions struct {
+	// 需要审计的模型.
+	Models []interface{}
+	// 审计表名, 默认 audit_records.
+	Table string
+	// 从 context 读取操作人.
+	Actor func(ctx context.Context) string
+	// 为 true 时, 不在 Manager.Transaction 或 db.Begin 开启的事务内的变更返回 ErrAuditRequiresTransaction, 不会执行.
+	// gorm 为单条写语句隐式开启的事务不计入.
+	RequireTransaction bool
+}
+
+// Audit 实现审计记录的 gorm 插件.
+//
+// 对配置的模型, 更新与删除前后查询变更行, 与操作人、操作一起写入审计表.
+// 审计查询与写入使用语句所在连接, 在 Manager.Transaction 内与变更同一事务提交或回滚.
+// 事务内变更前查询以 SELECT ... FOR UPDATE 锁定变更行; 事务外(包括 SkipDefaultTransaction 时)
+// 查询不加锁, 并发写入可能在查询与变更之间修改记录, 变更前数据仅为尽力而为.
+// 通过 RuntimeOptions.Plugins 注册.
+type Audit struct {
+	opts     AuditOptions
+	tables   map[string]*schema.Schema
+	schemas  sync.Map
+	provider *TransProvider
+}
+
+// NewAudit 创建审计插件.
+func NewAudit(opts AuditOptions) *Audit {
+	if opts.Table == "" {
+		opts.Table = "audit_records"
+	}
+	return &Audit{opts: opts, tables: make(map[string]*schema.Schema, len(opts.Models))}
+}
+
+func (a *Audit) bindProvider(p *TransProvider) {
+	a.provider = p
+}
+
+func (a *Audit) Name() string {
+	return auditPluginName
+}
+
+// Initialize 替换 gorm:update、gorm:delete, 在全部 Before 回调之后查询变更前数据.
+func (a *Audit) Initialize(db *gorm.DB) error {
+	for _, model := range a.opts.Models {
+		sch, err := schema.Parse(model, &a.schemas, db.NamingStrategy)
+		if err != nil {
+			return err
+		}
+		a.tables[sch.Table] = sch
+	}
+
+	for _, p := range []struct {
+		processor interface {
+			Get(name string) func(*gorm.DB)
+			Replace(name string, fn func(*gorm.DB)) error
+		}
+		name, operation string
+	}{
+		{db.Callback().Update(), "gorm:update", AuditUpdate},
+		{db.Callback().Delete(), "gorm:delete", AuditDelete},
+	} {
+		fn := p.processor.Get(p.name)
+		if fn == nil {
+			return fmt.Errorf("%s: %s callback not found", auditPluginName, p.name)
+		}
+		operation := p.operation
+		if err := p.processor.Replace(p.name, func(db *gorm.DB) {
+			a.audit(db, operation, fn)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Audit) audit(db *gorm.DB, operation string, exec func(*gorm.DB)) {
+	sch, ok := a.tables[db.Statement.Table]
+	if !ok || db.Error != nil || db.DryRun {
+		exec(db)
+		return
+	}
+
+	pool := db.Statement.ConnPool
+	if c, ok := pool.(*commentConnPool); ok {
+		pool = c.ConnPool
+	}
+	if a.opts.RequireTransaction && !a.inTransaction(db, pool) {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrAuditRequiresTransaction, sch.Table))
+		return
+	}
+	// 不经过注释包装, 使读写分离识别事务连接.
+	auditDB := func() *gorm.DB {
+		tx := db.Session(&gorm.Session{NewDB: true}).Clauses(dbresolver.Write)
+		tx.Statement.ConnPool = pool
+		return tx
+	}
+
+	exprs := primaryKeyConditions(db.Statement)
+	if where, ok := db.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		exprs = append(exprs, where.Exprs...)
+	}
+	if len(exprs) == 0 {
+		// 无条件的变更由 gorm 拒绝或为全表变更, 不做审计.
+		exec(db)
+		return
+	}
+	query := auditDB().Clauses(clause.Where{Exprs: exprs})
+	if _, ok := pool.(gorm.TxCommitter); ok {
+		// 锁定变更行, 避免并发写入使变更前数据失真.
+		query = query.Clauses(clause.Locking{Strength: LockingStrengthUpdate})
+	}
+	// 带 ORDER BY、LIMIT 的变更只影响部分匹配行.
+	for _, name := range []string{"ORDER BY", "LIMIT"} {
+		if c, ok := db.Statement.Clauses[name]; ok {
+			if expr, ok := c.Expression.(clause.Interface); ok {
+				query = query.Clauses(expr)
+			}
+		}
+	}
+	before, err := a.snapshot(query, sch)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+
+	exec(db)
+	if db.Error != nil || db.RowsAffected == 0 || len(before) == 0 {
+		return
+	}
+
+	var after map[string]json.RawMessage
+	if operation == AuditUpdate {
+		queryValues := make([][]interface{}, 0, len(before))
+		for _, row := range before {
+			queryValues = append(queryValues, row.pk)
+		}
+		column, values := schema.ToQueryValues(sch.Table, sch.PrimaryFieldDBNames, queryValues)
+		rows, err := a.snapshot(auditDB().Where(clause.IN{Column: column, Values: values}), sch)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		after = make(map[string]json.RawMessage, len(rows))
+		for _, row := range rows {
+			after[row.id] = row.data
+		}
+	}
+
+	var actor string
+	if a.opts.Actor != nil {
+		actor = a.opts.Actor(db.Statement.Context)
+	}
+	records := make([]*AuditRecord, 0, len(before))
+	for _, row := range before {
+		records = append(records, &AuditRecord{
+			Table:     sch.Table,
+			RowID:     row.id,
+			Operation: operation,
+			Actor:     actor,
+			Before:    row.data,
+			After:     after[row.id],
+		})
+	}
+	_ = db.AddError(auditDB().Table(a.opts.Table).Create(&records).Error)
+}
+
+// inTransaction 判断变更是否在 Manager.Transaction 或 db.Begin 开启的事务内.
+func (a *Audit) inTransaction(db *gorm.DB, pool gorm.ConnPool) bool {
+	if a.provider != nil && a.provider.isInTransaction(db.Statement.Context) {
+		return true
+	}
+	if _, ok := pool.(gorm.TxCommitter); !ok {
+		return false
+	}
+	_, implicit := db.InstanceGet("gorm:started_transaction")
+	return !implicit
+}
+
+type auditRow struct {
+	id   string
+	pk   []interface{}
+	data json.RawMessage
+}
+
+// snapshot 查询变更行, 以 JSON 保存.
+func (a *Audit) snapshot(db *gorm.DB, sch *schema.Schema) ([]auditRow, error) {
+	rows := reflect.New(reflect.SliceOf(sch.ModelType))
+	if err := db.Model(reflect.New(sch.ModelType).Interface()).Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	rows = rows.Elem()
+	result := make([]auditRow, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		rv := rows.Index(i)
+		data, err := json.Marshal(rv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		row := auditRow{data: data, pk: make([]interface{}, len(sch.PrimaryFields))}
+		ids := make([]string, len(sch.PrimaryFields))
+		for j, field := range sch.PrimaryFields {
+			row.pk[j], _ = field.ValueOf(db.Statement.Context, rv)
+			ids[j] = fmt.Sprint(row.pk[j])
+		}
+		row.id = strings.Join(ids, ",")
+		result = append(result, row)
+	}
+	return result, nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBulkBatchSize 默认每批写入行数.
+const DefaultBulkBatchSize = 500
+
+// MySQL 预处理语句最多支持的占位符数量.
+const maxPlaceholders = 65535
+
+// 未能获取 max_allowed_packet 时使用的默认值, 同 MySQL 8.0 默认值.
+const defaultMaxAllowedPacket = 64 << 20
+
+// BulkOptions 批量写入配置.
+type BulkOptions struct {
+	// 每批最大行数, 默认 DefaultBulkBatchSize.
+	// 实际行数不超过 65535 / 列数, 避免超出 MySQL 占位符上限.
+	BatchSize int
+	// 每批 SQL 最大字节数(估算), 默认取 max_allowed_packet 的 80%.
+	MaxBatchBytes int
+	// 冲突判定列, ON CONFLICT 方言使用, MySQL 依据唯一索引判定.
+	ConflictColumns []string
+	// 冲突时更新的列, 为空时更新除主键外的全部列.
+	UpdateColumns []string
+	// 冲突时忽略.
+	DoNothing bool
+	// 某批失败后是否继续写入后续批次.
+	ContinueOnError bool
+	// 每批写入完成后回调.
+	OnBatch func(BatchResult)
+}
+
+// BatchResult 单批写入结果.
+type BatchResult struct {
+	// 批次序号, 从 0 开始.
+	Index int
+	// 本批起始行在输入中的下标.
+	Offset int
+	// 本批行数.
+	Rows int
+	// 影响行数, MySQL upsert 时更新的行计为 2.
+	RowsAffected int64
+	Err          error
+}
+
+// BulkInsert 通过 UseWriteDB 分批插入.
+//
+// 返回每批结果, 以及首个批次错误.
+func BulkInsert[T any](ctx context.Context, p Provider, rows []*T, opts BulkOptions) ([]BatchResult, error) {
+	return bulkWrite(ctx, p, rows, opts, nil)
+}
+
+// BulkUpsert 通过 UseWriteDB 分批写入, 冲突时更新.
+//
+// MySQL 生成 ON DUPLICATE KEY UPDATE, 其他方言生成 ON CONFLICT.
+func BulkUpsert[T any](ctx context.Context, p Provider, rows []*T, opts BulkOptions) ([]BatchResult, error) {
+	onConflict := clause.OnConflict{DoNothing: opts.DoNothing}
+	for _, col := range opts.ConflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: col})
+	}
+	switch {
+	case opts.DoNothing:
+	case len(opts.UpdateColumns) > 0:
+		onConflict.DoUpdates = clause.AssignmentColumns(opts.UpdateColumns)
+	default:
+		onConflict.UpdateAll = true
+	}
+	return bulkWrite(ctx, p, rows, opts, &onConflict)
+}
+
+func bulkWrite[T any](ctx context.Context, p Provider, rows []*T, opts BulkOptions, onConflict *clause.OnConflict) ([]BatchResult, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	db := p.UseWriteDB(ctx)
+	if db == nil {
+		return nil, ErrWriteDBNotConfigured
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	if columns := insertColumns(stmt.Schema); columns > 0 {
+		batchSize = min(batchSize, max(maxPlaceholders/columns, 1))
+	}
+	maxBytes := opts.MaxBatchBytes
+	if maxBytes <= 0 {
+		maxBytes = maxAllowedPacket(db) / 5 * 4
+	}
+
+	var (
+		results  []BatchResult
+		firstErr error
+	)
+	for offset, index := 0, 0; offset < len(rows); index++ {
+		end := nextBatchEnd(ctx, stmt.Schema, rows, offset, batchSize, maxBytes)
+		tx := db.Session(&gorm.Session{})
+		if onConflict != nil {
+			tx = tx.Clauses(*onConflict)
+		}
+		res := tx.Create(rows[offset:end])
+
+		result := BatchResult{Index: index, Offset: offset, Rows: end - offset, RowsAffected: res.RowsAffected, Err: res.Error}
+		results = append(results, result)
+		if opts.OnBatch != nil {
+			opts.OnBatch(result)
+		}
+		if res.Error != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("bulk write batch %d (rows %d-%d): %w", index, offset, end-1, res.Error)
+			}
+			if !opts.ContinueOnError {
+				break
+			}
+		}
+		offset = end
+	}
+	return results, firstErr
+}
+
+// nextBatchEnd 计算从 offset 开始的批次结束位置, 同时受行数和估算字节数限制.
+func nextBatchEnd[T any](ctx context.Context, s *schema.Schema, rows []*T, offset, batchSize, maxBytes int) int {
+	end, size := offset, 0
+	for end < len(rows) && end-offset < batchSize {
+		rowSize := estimateRowSize(ctx, s, rows[end])
+		// 单行超过限制时依然单独成批, 由数据库返回错误.
+		if end > offset && size+rowSize > maxBytes {
+			break
+		}
+		size += rowSize
+		end++
+	}
+	return end
+}
+
+// insertColumns 返回 INSERT 语句的最大列数.
+func insertColumns(s *schema.Schema) int {
+	n := 0
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.Creatable {
+			n++
+		}
+	}
+	return n
+}
+
+// estimateRowSize 估算一行在 INSERT VALUES 中占用的字节数.
+func estimateRowSize[T any](ctx context.Context, s *schema.Schema, row *T) int {
+	rv := reflect.ValueOf(row).Elem()
+	size := 2
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Creatable {
+			continue
+		}
+		v, _ := field.ValueOf(ctx, rv)
+		switch val := v.(type) {
+		case string:
+			size += len(val) + 3
+		case []byte:
+			// 十六进制表示.
+			size += 2*len(val) + 3
+		case nil:
+			size += 5
+		default:
+			size += len(fmt.Sprint(val)) + 3
+		}
+	}
+	return size
+}
+
+// maxAllowedPacket 查询 MySQL max_allowed_packet, 其他方言返回默认值.
+func maxAllowedPacket(db *gorm.DB) int {
+	if db.Dialector.Name() != "mysql" {
+		return defaultMaxAllowedPacket
+	}
+	var packet int
+	if err := db.Session(&gorm.Session{NewDB: true, Context: AllowRawSQL(db.Statement.Context)}).Raw("SELECT @@max_allowed_packet").Scan(&packet).Error; err != nil || packet <= 0 {
+		return defaultMaxAllowedPacket
+	}
+	return packet
+}
@@ -0,0 +1,469 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const queryCacheName = "driver:query_cache"
+
+// CacheBackend 查询缓存存储.
+type CacheBackend interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration)
+	Delete(ctx context.Context, keys ...string)
+}
+
+// CacheOptions 查询缓存配置.
+type CacheOptions struct {
+	// 缓存存储, 默认为容量 Capacity 的内存 LRU.
+	Backend CacheBackend
+	// 内存 LRU 容量, 默认 10000.
+	// 同时作为主键缓存 context 片段的记录上限, 超出时失效全部主键缓存.
+	Capacity int
+	// 缓存过期时间, 默认 1 分钟.
+	TTL time.Duration
+	// 返回附加到缓存 key 的 context 值.
+	// 全局 scope 依赖 context 时需设置, 租户隔离与软删除的 context 已包含在 key 中.
+	ContextKey func(ctx context.Context) string
+}
+
+// cacheScoper 查询结果依赖 context 的插件, 返回值附加到缓存 key.
+type cacheScoper interface {
+	cacheScope(ctx context.Context) string
+}
+
+// QueryCache 读穿透查询缓存.
+//
+// 需通过 RuntimeOptions.Plugins 注册, 由 NewProvider 绑定 Provider.
+// 写操作在事务提交后失效缓存, 事务内的读不经过缓存, 回滚的事务不影响缓存.
+//
+// 按主键的缓存在对应行写入后失效, 查询缓存在表有任意写入后失效.
+// 原生 SQL (Exec/Raw) 写入无法识别, 需调用 Invalidate 手动失效.
+//
+// 失效通过进程内的表版本号实现, 多副本部署时其他副本依赖 TTL 过期.
+// 缓存 key 包含生效的全局 scope 与租户、软删除等 context, WithScopes 附加 scope 时不经过缓存.
+type QueryCache struct {
+	backend    CacheBackend
+	ttl        time.Duration
+	capacity   int
+	contextKey func(ctx context.Context) string
+	provider   *TransProvider
+
+	mut sync.Mutex
+	// 表版本号, 查询缓存与全表缓存的 key 包含版本号.
+	queryGens map[string]uint64
+	tableGens map[string]uint64
+	// 主键缓存 key 对应的 context 片段, 失效时一并删除.
+	// 片段数量超过 capacity 时清空并递增 pkEpoch, 使已记录的主键缓存不可达.
+	pkScopes    map[string]map[string]struct{}
+	pkScopeSize int
+	pkEpoch     uint64
+}
+
+// NewQueryCache 创建查询缓存.
+func NewQueryCache(optsList ...*CacheOptions) *QueryCache {
+	var opts CacheOptions
+	if len(optsList) > 0 && optsList[0] != nil {
+		opts = *optsList[0]
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 10000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.Backend == nil {
+		opts.Backend = NewLRUCacheBackend(opts.Capacity)
+	}
+	return &QueryCache{
+		backend:    opts.Backend,
+		ttl:        opts.TTL,
+		capacity:   opts.Capacity,
+		contextKey: opts.ContextKey,
+		queryGens:  make(map[string]uint64),
+		tableGens:  make(map[string]uint64),
+		pkScopes:   make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *QueryCache) bindProvider(p *TransProvider) {
+	c.provider = p
+}
+
+func (c *QueryCache) Name() string {
+	return queryCacheName
+}
+
+func (c *QueryCache) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register(queryCacheName, c.afterWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register(queryCacheName, c.afterWrite); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register(queryCacheName, c.afterWrite)
+}
+
+// afterWrite 写入成功后失效相关缓存.
+func (c *QueryCache) afterWrite(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 || stmt.Table == "" || c.provider == nil {
+		return
+	}
+	c.Invalidate(stmt.Context, stmt.Table, writtenPrimaryKeys(db)...)
+}
+
+// writtenPrimaryKeys 返回写入对象的主键, 无法确定时返回 nil.
+func writtenPrimaryKeys(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	if stmt.Schema == nil || len(stmt.Schema.PrimaryFields) != 1 {
+		return nil
+	}
+	pf := stmt.Schema.PrioritizedPrimaryField
+	if pf == nil {
+		pf = stmt.Schema.PrimaryFields[0]
+	}
+
+	var ids []interface{}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		v, isZero := pf.ValueOf(stmt.Context, stmt.ReflectValue)
+		if isZero {
+			return nil
+		}
+		ids = append(ids, v)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			v, isZero := pf.ValueOf(stmt.Context, reflect.Indirect(stmt.ReflectValue.Index(i)))
+			if isZero {
+				return nil
+			}
+			ids = append(ids, v)
+		}
+	}
+	return ids
+}
+
+// Invalidate 失效表缓存.
+//
+// ids 为空时失效全表缓存, 否则失效对应主键缓存及表的查询缓存.
+// 在事务上下文内时延迟到事务提交后执行. 未绑定 Provider 时无缓存, 直接返回.
+func (c *QueryCache) Invalidate(ctx context.Context, table string, ids ...interface{}) {
+	if c.provider == nil {
+		return
+	}
+	source := c.provider.getWriteDBName(ctx)
+	invalidate := func(ctx context.Context) {
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, c.primaryKey(source, table, id))
+		}
+
+		c.mut.Lock()
+		key := source + "." + table
+		c.queryGens[key]++
+		if len(ids) == 0 {
+			c.tableGens[key]++
+			// 旧版本号的主键缓存已不可达.
+			prefix := source + "/" + table + "/"
+			for pk, scopes := range c.pkScopes {
+				if strings.HasPrefix(pk, prefix) {
+					c.pkScopeSize -= len(scopes)
+					delete(c.pkScopes, pk)
+				}
+			}
+		}
+		for _, pk := range keys {
+			for scope := range c.pkScopes[pk] {
+				keys = append(keys, pk+"/"+scope)
+			}
+			c.pkScopeSize -= len(c.pkScopes[pk])
+			delete(c.pkScopes, pk)
+		}
+		c.mut.Unlock()
+
+		if len(keys) > 0 {
+			c.backend.Delete(ctx, keys...)
+		}
+	}
+	if !c.provider.OnCommitted(ctx, invalidate) {
+		invalidate(ctx)
+	}
+}
+
+func (c *QueryCache) primaryKey(source, table string, id interface{}) string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.primaryKeyLocked(source, table, id)
+}
+
+func (c *QueryCache) primaryKeyLocked(source, table string, id interface{}) string {
+	return fmt.Sprintf("%s/%s/%d/pk%d/%s", source, table, c.tableGens[source+"."+table], c.pkEpoch, cacheID(id))
+}
+
+// generation 返回表的写入版本号, 表有任意失效时递增.
+func (c *QueryCache) generation(source, table string) uint64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.queryGens[source+"."+table]
+}
+
+// cacheID 规范化主键, 使调用方传入的主键与 binlog 解码的主键生成相同的 key.
+//
+// 指针取值, []byte 按字符串处理, 各整数类型按十进制格式化.
+func cacheID(id interface{}) string {
+	rv := reflect.ValueOf(id)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+	}
+	return fmt.Sprint(id)
+}
+
+// scopedPrimaryKey 返回附加 context 片段的主键缓存 key, 并记录片段用于失效.
+func (c *QueryCache) scopedPrimaryKey(source, table string, id interface{}, scope string) string {
+	if scope == "" {
+		return c.primaryKey(source, table, id)
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.pkScopeSize >= c.capacity {
+		// 超出记录上限, 递增 pkEpoch 使全部主键缓存不可达, 由存储按 TTL 或 LRU 淘汰.
+		c.pkScopes = make(map[string]map[string]struct{})
+		c.pkScopeSize = 0
+		c.pkEpoch++
+	}
+	key := c.primaryKeyLocked(source, table, id)
+	scopes, ok := c.pkScopes[key]
+	if !ok {
+		scopes = make(map[string]struct{})
+		c.pkScopes[key] = scopes
+	}
+	if _, ok := scopes[scope]; !ok {
+		scopes[scope] = struct{}{}
+		c.pkScopeSize++
+	}
+	return key + "/" + scope
+}
+
+func (c *QueryCache) queryKey(source, table, key string) string {
+	c.mut.Lock()
+	gen := strconv.FormatUint(c.tableGens[source+"."+table], 10) + "." + strconv.FormatUint(c.queryGens[source+"."+table], 10)
+	c.mut.Unlock()
+	return fmt.Sprintf("%s/%s/%s/q/%s", source, table, gen, key)
+}
+
+// scopeKey 返回 context 相关的缓存 key 片段, 包含生效的全局 scope、插件与 ContextKey 的值.
+//
+// context 通过 WithScopes 附加了 scope 时无法确定查询条件, 返回 false.
+func (c *QueryCache) scopeKey(ctx context.Context, db *gorm.DB) (string, bool) {
+	if sc, ok := ctx.Value(scopeControlCtxKey{}).(*scopeControl); ok && len(sc.scopes) > 0 {
+		return "", false
+	}
+	var parts []string
+	if c.provider.scopes != nil {
+		parts = append(parts, "scopes="+strings.Join(c.provider.ActiveScopes(ctx), ","))
+	}
+	names := make([]string, 0, len(db.Config.Plugins))
+	for name := range db.Config.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if scoper, ok := db.Config.Plugins[name].(cacheScoper); ok {
+			parts = append(parts, name+"="+scoper.cacheScope(ctx))
+		}
+	}
+	if c.contextKey != nil {
+		parts = append(parts, "ctx="+c.contextKey(ctx))
+	}
+	if len(parts) == 0 {
+		return "", true
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:16]), true
+}
+
+func (c *QueryCache) tableOf(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Table, nil
+}
+
+// GetCached 按主键读穿透查询, 未找到返回 gorm.ErrRecordNotFound, 不缓存空结果.
+func GetCached[T any](ctx context.Context, c *QueryCache, id interface{}) (*T, error) {
+	load := func(db *gorm.DB) (*T, error) {
+		entity := new(T)
+		if err := db.Model(entity).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Take(entity).Error; err != nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+	db := c.provider.UseDB(ctx)
+	// 事务内可能读到未提交数据, 不经过缓存.
+	if c.provider.isInTransaction(ctx) {
+		return load(db)
+	}
+	scope, ok := c.scopeKey(ctx, db)
+	if !ok {
+		return load(db)
+	}
+	table, err := c.tableOf(db, new(T))
+	if err != nil {
+		return nil, err
+	}
+	key := c.scopedPrimaryKey(c.provider.getWriteDBName(ctx), table, id, scope)
+	return readThrough(ctx, c, c.provider.getWriteDBName(ctx), table, key, func() (*T, error) { return load(db) })
+}
+
+// QueryCached 按自定义 key 读穿透查询, 模型 T 所在表有写入时失效.
+//
+// key 需唯一对应 query 的条件.
+func QueryCached[T any](ctx context.Context, c *QueryCache, key string, query Scope) ([]*T, error) {
+	load := func(db *gorm.DB) ([]*T, error) {
+		var entities []*T
+		if err := db.Model(new(T)).Scopes(query).Find(&entities).Error; err != nil {
+			return nil, err
+		}
+		return entities, nil
+	}
+	db := c.provider.UseDB(ctx)
+	if c.provider.isInTransaction(ctx) {
+		return load(db)
+	}
+	scope, ok := c.scopeKey(ctx, db)
+	if !ok {
+		return load(db)
+	}
+	table, err := c.tableOf(db, new(T))
+	if err != nil {
+		return nil, err
+	}
+	cacheKey := c.queryKey(c.provider.getWriteDBName(ctx), table, scope+"/"+key)
+	entities, err := readThrough(ctx, c, c.provider.getWriteDBName(ctx), table, cacheKey, func() (*[]*T, error) {
+		entities, err := load(db)
+		return &entities, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return *entities, nil
+}
+
+// readThrough 读取缓存, 未命中时加载并写入缓存.
+//
+// 加载期间表有失效时不写入缓存, 写入后才发生失效时删除写入的值, 避免旧数据留到过期.
+func readThrough[T any](ctx context.Context, c *QueryCache, source, table, key string, load func() (*T, error)) (*T, error) {
+	if data, ok := c.backend.Get(ctx, key); ok {
+		value := new(T)
+		if err := json.Unmarshal(data, value); err == nil {
+			return value, nil
+		}
+	}
+	gen := c.generation(source, table)
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if c.generation(source, table) != gen {
+		return value, nil
+	}
+	if data, err := json.Marshal(value); err == nil {
+		c.backend.Set(ctx, key, data, c.ttl)
+		if c.generation(source, table) != gen {
+			c.backend.Delete(ctx, key)
+		}
+	}
+	return value, nil
+}
+
+// lruCacheBackend 内存 LRU 缓存存储.
+type lruCacheBackend struct {
+	mut      sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// NewLRUCacheBackend 创建内存 LRU 缓存存储.
+func NewLRUCacheBackend(capacity int) CacheBackend {
+	return &lruCacheBackend{capacity: capacity, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (b *lruCacheBackend) Get(ctx context.Context, key string) ([]byte, bool) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	elem, ok := b.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		b.order.Remove(elem)
+		delete(b.items, key)
+		return nil, false
+	}
+	b.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (b *lruCacheBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if elem, ok := b.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expireAt = value, time.Now().Add(ttl)
+		b.order.MoveToFront(elem)
+		return
+	}
+	b.items[key] = b.order.PushFront(&lruEntry{key: key, value: value, expireAt: time.Now().Add(ttl)})
+	for b.order.Len() > b.capacity {
+		oldest := b.order.Back()
+		b.order.Remove(oldest)
+		delete(b.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (b *lruCacheBackend) Delete(ctx context.Context, keys ...string) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	for _, key := range keys {
+		if elem, ok := b.items[key]; ok {
+			b.order.Remove(elem)
+			delete(b.items, key)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// 事件类型.
+const (
+	queryEvent             = 2
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	xidEvent               = 16
+	tableMapEvent          = 19
+	writeRowsEventV1       = 23
+	updateRowsEventV1      = 24
+	deleteRowsEventV1      = 25
+	heartbeatEvent         = 27
+	writeRowsEventV2       = 30
+	updateRowsEventV2      = 31
+	deleteRowsEventV2      = 32
+	partialUpdateRowsEvent = 39
+)
+
+const eventHeaderSize = 19
+
+// binlogMagic binlog 文件头.
+var binlogMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+var errMalformedEvent = errors.New("cdc: malformed binlog event")
+
+type eventHeader struct {
+	Timestamp uint32
+	Type      byte
+	ServerID  uint32
+	EventSize uint32
+	// 下一事件在文件中的位置, 人工事件为 0.
+	LogPos uint32
+	Flags  uint16
+}
+
+// parser 解析 binlog 事件, 维护校验和设置与表映射.
+type parser struct {
+	checksum bool
+	// 是否已收到 FORMAT_DESCRIPTION_EVENT.
+	formatSeen bool
+	tables     map[uint64]*tableMap
+}
+
+func newParser() *parser {
+	return &parser{tables: make(map[uint64]*tableMap)}
+}
+
+// parse 解析事件头, 校验并去除 CRC32, 返回事件体.
+func (p *parser) parse(data []byte) (eventHeader, []byte, error) {
+	if len(data) < eventHeaderSize {
+		return eventHeader{}, nil, errMalformedEvent
+	}
+	h := eventHeader{
+		Timestamp: binary.LittleEndian.Uint32(data),
+		Type:      data[4],
+		ServerID:  binary.LittleEndian.Uint32(data[5:]),
+		EventSize: binary.LittleEndian.Uint32(data[9:]),
+		LogPos:    binary.LittleEndian.Uint32(data[13:]),
+		Flags:     binary.LittleEndian.Uint16(data[17:]),
+	}
+	if int(h.EventSize) != len(data) {
+		return h, nil, errMalformedEvent
+	}
+	if h.Type == formatDescriptionEvent {
+		p.checksum = formatChecksum(data[eventHeaderSize:])
+		p.formatSeen = true
+	}
+	if !p.formatSeen {
+		// 连接开始的人工 ROTATE_EVENT 先于 FORMAT_DESCRIPTION_EVENT,
+		// 设置 @master_binlog_checksum 后带有校验和, 只能按内容判断.
+		if h.Type == rotateEvent && hasChecksum(data) {
+			data = data[:len(data)-4]
+		}
+		return h, data[eventHeaderSize:], nil
+	}
+	if p.checksum {
+		if len(data) < eventHeaderSize+4 {
+			return h, nil, errMalformedEvent
+		}
+		n := len(data) - 4
+		if crc32.ChecksumIEEE(data[:n]) != binary.LittleEndian.Uint32(data[n:]) {
+			return h, nil, fmt.Errorf("cdc: binlog event checksum mismatch at %d", h.LogPos)
+		}
+		data = data[:n]
+	}
+	return h, data[eventHeaderSize:], nil
+}
+
+// hasChecksum 判断事件末尾 4 字节是否为 CRC32 校验和.
+func hasChecksum(data []byte) bool {
+	n := len(data) - 4
+	return n > eventHeaderSize && crc32.ChecksumIEEE(data[:n]) == binary.LittleEndian.Uint32(data[n:])
+}
+
+// formatChecksum 从 FORMAT_DESCRIPTION_EVENT 读取校验和算法, 5.6.1 之前不支持校验和.
+func formatChecksum(body []byte) bool {
+	if len(body) < 2+50+5 {
+		return false
+	}
+	version := strings.TrimRight(string(body[2:52]), "\x00")
+	if !versionAtLeast(version, 5, 6, 1) {
+		return false
+	}
+	return body[len(body)-5] == 1 // BINLOG_CHECKSUM_ALG_CRC32
+}
+
+func versionAtLeast(version string, want ...int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	for i, w := range want {
+		if i >= len(parts) {
+			return false
+		}
+		end := 0
+		for end < len(parts[i]) && parts[i][end] >= '0' && parts[i][end] <= '9' {
+			end++
+		}
+		v, _ := strconv.Atoi(parts[i][:end])
+		if v != w {
+			return v > w
+		}
+	}
+	return true
+}
+
+// parseRotate 返回下一 binlog 文件位点.
+func parseRotate(body []byte) (Position, error) {
+	if len(body) < 8 {
+		return Position{}, errMalformedEvent
+	}
+	return Position{File: string(body[8:]), Pos: uint32(binary.LittleEndian.Uint64(body))}, nil
+}
+
+// parseQuery 返回语句所在库与语句.
+func parseQuery(body []byte) (schema, query string, err error) {
+	if len(body) < 13 {
+		return "", "", errMalformedEvent
+	}
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:]))
+	pos := 13 + statusLen
+	if len(body) < pos+schemaLen+1 {
+		return "", "", errMalformedEvent
+	}
+	return string(body[pos : pos+schemaLen]), string(body[pos+schemaLen+1:]), nil
+}
+
+// readLenEnc 读取长度编码整数, 返回值与占用字节数.
+func readLenEnc(data []byte) (uint64, int) {
+	switch data[0] {
+	case 0xfc:
+		return uint64(binary.LittleEndian.Uint16(data[1:])), 3
+	case 0xfd:
+		return uint64(data[1]) | uint64(data[2])<<8 | uint64(data[3])<<16, 4
+	case 0xfe:
+		return binary.LittleEndian.Uint64(data[1:]), 9
+	default:
+		return uint64(data[0]), 1
+	}
+}
+
+func readLenEncString(data []byte) (string, int) {
+	n, size := readLenEnc(data)
+	return string(data[size : size+int(n)]), size + int(n)
+}
+
+func readTableID(data []byte) uint64 {
+	return uint64(binary.LittleEndian.Uint32(data)) | uint64(binary.LittleEndian.Uint16(data[4:]))<<32
+}
+
+// column 表映射中的列定义.
+type column struct {
+	name string
+	// 真实类型, STRING 已按元数据转换为 ENUM/SET.
+	typ      byte
+	meta     uint16
+	nullable bool
+	unsigned bool
+	binary   bool
+	// ENUM/SET 取值.
+	values []string
+}
+
+// tableMap TABLE_MAP_EVENT 定义的表结构.
+type tableMap struct {
+	id      uint64
+	schema  string
+	table   string
+	columns []*column
+
+	// 可选元数据是否包含对应信息, 缺失时从 information_schema 补充.
+	hasNames    bool
+	hasSign     bool
+	hasCharset  bool
+	hasEnumVals bool
+}
+
+func (t *tableMap) names() []string {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// 可选元数据类型.
+const (
+	metaSignedness     = 1
+	metaDefaultCharset = 2
+	metaColumnCharset  = 3
+	metaColumnName     = 4
+	metaSetStrValue    = 5
+	metaEnumStrValue   = 6
+)
+
+const binaryCollation = 63
+
+// parseTableMap 解析 TABLE_MAP_EVENT.
+func parseTableMap(body []byte) (t *tableMap, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t, err = nil, fmt.Errorf("%w: table map: %v", errMalformedEvent, r)
+		}
+	}()
+
+	t = &tableMap{id: readTableID(body)}
+	pos := 8
+	n := int(body[pos])
+	t.schema = string(body[pos+1 : pos+1+n])
+	pos += 1 + n + 1
+	n = int(body[pos])
+	t.table = string(body[pos+1 : pos+1+n])
+	pos += 1 + n + 1
+
+	count, size := readLenEnc(body[pos:])
+	pos += size
+	t.columns = make([]*column, count)
+	for i := range t.columns {
+		t.columns[i] = &column{name: "@" + strconv.Itoa(i+1), typ: body[pos+i]}
+	}
+	pos += int(count)
+
+	metaLen, size := readLenEnc(body[pos:])
+	pos += size
+	meta := body[pos : pos+int(metaLen)]
+	pos += int(metaLen)
+	m := 0
+	for _, c := range t.columns {
+		switch c.typ {
+		case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON, typeTime2, typeDateTime2, typeTimestamp2:
+			c.meta = uint16(meta[m])
+			m++
+		case typeVarchar, typeVarString:
+			c.meta = binary.LittleEndian.Uint16(meta[m:])
+			m += 2
+		case typeNewDecimal, typeBit, typeEnum, typeSet:
+			c.meta = uint16(meta[m])<<8 | uint16(meta[m+1])
+			m += 2
+		case typeString:
+			b0, b1 := meta[m], meta[m+1]
+			m += 2
+			if b0&0x30 != 0x30 {
+				// 长度超过 255 时高位存储在类型字节中
+				c.typ, c.meta = b0|0x30, uint16(b1)|uint16((b0&0x30)^0x30)<<4
+			} else {
+				c.typ, c.meta = b0, uint16(b1)
+			}
+		}
+	}
+
+	nullBitmap := body[pos : pos+(len(t.columns)+7)/8]
+	pos += len(nullBitmap)
+	for i, c := range t.columns {
+		c.nullable = nullBitmap[i/8]&(1<<(i%8)) != 0
+	}
+
+	for pos < len(body) {
+		typ := body[pos]
+		n, size := readLenEnc(body[pos+1:])
+		value := body[pos+1+size : pos+1+size+int(n)]
+		pos += 1 + size + int(n)
+		t.parseOptionalMeta(typ, value)
+	}
+	return t, nil
+}
+
+// parseOptionalMeta 解析 binlog_row_metadata 写入的可选元数据.
+func (t *tableMap) parseOptionalMeta(typ byte, value []byte) {
+	switch typ {
+	case metaSignedness:
+		t.hasSign = true
+		i := 0
+		for _, c := range t.columns {
+			if isNumericType(c.typ) {
+				c.unsigned = value[i/8]&(0x80>>(i%8)) != 0
+				i++
+			}
+		}
+	case metaDefaultCharset:
+		t.hasCharset = true
+		collation, pos := readLenEnc(value)
+		columns := t.characterColumns()
+		for _, c := range columns {
+			c.binary = collation == binaryCollation
+		}
+		for pos < len(value) {
+			idx, size := readLenEnc(value[pos:])
+			pos += size
+			collation, size := readLenEnc(value[pos:])
+			pos += size
+			if int(idx) < len(columns) {
+				columns[idx].binary = collation == binaryCollation
+			}
+		}
+	case metaColumnCharset:
+		t.hasCharset = true
+		pos := 0
+		for _, c := range t.characterColumns() {
+			collation, size := readLenEnc(value[pos:])
+			pos += size
+			c.binary = collation == binaryCollation
+		}
+	case metaColumnName:
+		t.hasNames = true
+		pos := 0
+		for _, c := range t.columns {
+			name, size := readLenEncString(value[pos:])
+			pos += size
+			c.name = name
+		}
+	case metaSetStrValue, metaEnumStrValue:
+		t.hasEnumVals = true
+		want := byte(typeSet)
+		if typ == metaEnumStrValue {
+			want = typeEnum
+		}
+		pos := 0
+		for _, c := range t.columns {
+			if c.typ != want {
+				continue
+			}
+			count, size := readLenEnc(value[pos:])
+			pos += size
+			c.values = make([]string, count)
+			for i := range c.values {
+				c.values[i], size = readLenEncString(value[pos:])
+				pos += size
+			}
+		}
+	}
+}
+
+// characterColumns 返回有字符集的列, 顺序同可选元数据.
+func (t *tableMap) characterColumns() []*column {
+	var columns []*column
+	for _, c := range t.columns {
+		switch c.typ {
+		case typeString, typeVarchar, typeVarString, typeBlob:
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
+
+func isNumericType(typ byte) bool {
+	switch typ {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong, typeFloat, typeDouble, typeNewDecimal:
+		return true
+	}
+	return false
+}
+
+// rowsEvent 行事件.
+type rowsEvent struct {
+	table *tableMap
+	op    Operation
+	// 每行变更前后的值, 插入时 before 为 nil, 删除时 after 为 nil.
+	rows [][2][]interface{}
+}
+
+func rowsOperation(typ byte) (Operation, bool) {
+	switch typ {
+	case writeRowsEventV1, writeRowsEventV2:
+		return OpInsert, true
+	case updateRowsEventV1, updateRowsEventV2:
+		return OpUpdate, true
+	case deleteRowsEventV1, deleteRowsEventV2:
+		return OpDelete, true
+	}
+	return "", false
+}
+
+// tableOf 返回行事件对应的表映射.
+func (p *parser) tableOf(body []byte) (*tableMap, error) {
+	if len(body) < 6 {
+		return nil, errMalformedEvent
+	}
+	t, ok := p.tables[readTableID(body)]
+	if !ok {
+		return nil, fmt.Errorf("cdc: table map %d not found", readTableID(body))
+	}
+	return t, nil
+}
+
+// parseRows 解析 WRITE/UPDATE/DELETE_ROWS_EVENT.
+func (p *parser) parseRows(typ byte, body []byte, t *tableMap, dec *decoder) (e *rowsEvent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, err = nil, fmt.Errorf("%w: rows of %s.%s: %v", errMalformedEvent, t.schema, t.table, r)
+		}
+	}()
+
+	op, _ := rowsOperation(typ)
+	e = &rowsEvent{table: t, op: op}
+	pos := 8
+	if typ >= writeRowsEventV2 {
+		pos += int(binary.LittleEndian.Uint16(body[pos:]))
+	}
+	count, size := readLenEnc(body[pos:])
+	pos += size
+	if int(count) != len(t.columns) {
+		return nil, fmt.Errorf("cdc: %s.%s column count %d, table map %d", t.schema, t.table, count, len(t.columns))
+	}
+	bitmapSize := (int(count) + 7) / 8
+	present := [2][]byte{body[pos : pos+bitmapSize]}
+	pos += bitmapSize
+	if op == OpUpdate {
+		present[1] = body[pos : pos+bitmapSize]
+		pos += bitmapSize
+	}
+
+	for pos < len(body) {
+		var row [2][]interface{}
+		switch op {
+		case OpInsert:
+			row[1], size, err = dec.row(t, present[0], body[pos:])
+		case OpDelete:
+			row[0], size, err = dec.row(t, present[0], body[pos:])
+		case OpUpdate:
+			row[0], size, err = dec.row(t, present[0], body[pos:])
+			if err == nil {
+				pos += size
+				row[1], size, err = dec.row(t, present[1], body[pos:])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		pos += size
+		e.rows = append(e.rows, row)
+	}
+	return e, nil
+}
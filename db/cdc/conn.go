@@ -0,0 +1,400 @@
+package cdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 客户端能力标志.
+const (
+	clientLongPassword     = 0x00000001
+	clientLongFlag         = 0x00000004
+	clientProtocol41       = 0x00000200
+	clientTransactions     = 0x00002000
+	clientSecureConnection = 0x00008000
+	clientPluginAuth       = 0x00080000
+)
+
+// 命令.
+const (
+	comQuery         = 0x03
+	comBinlogDump    = 0x12
+	comRegisterSlave = 0x15
+)
+
+const maxPacketSize = 1<<24 - 1
+
+var errMalformedPacket = errors.New("cdc: malformed packet")
+
+// serverError 服务端返回的 ERR 包.
+type serverError struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("cdc: mysql error %d (%s): %s", e.Code, e.State, e.Message)
+}
+
+func parseErrPacket(data []byte) error {
+	if len(data) < 3 {
+		return errMalformedPacket
+	}
+	e := &serverError{Code: binary.LittleEndian.Uint16(data[1:])}
+	msg := data[3:]
+	if len(msg) > 6 && msg[0] == '#' {
+		e.State, msg = string(msg[1:6]), msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
+
+// conn 实现复制所需的 MySQL 客户端协议.
+type conn struct {
+	nc  net.Conn
+	br  *bufio.Reader
+	seq byte
+}
+
+func dial(ctx context.Context, addr string, timeout time.Duration) (*conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{nc: nc, br: bufio.NewReaderSize(nc, 64<<10)}, nil
+}
+
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
+
+// readPacket 读取完整负载, 合并超过 16MB 的分包. 复制协议不存在空负载.
+func (c *conn) readPacket() ([]byte, error) {
+	var payload []byte
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(c.br, header); err != nil {
+			return nil, err
+		}
+		size := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+		data := make([]byte, size)
+		if _, err := io.ReadFull(c.br, data); err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			payload = data
+		} else {
+			payload = append(payload, data...)
+		}
+		if size < maxPacketSize {
+			break
+		}
+	}
+	if len(payload) == 0 {
+		return nil, errMalformedPacket
+	}
+	return payload, nil
+}
+
+func (c *conn) writePacket(data []byte) error {
+	for {
+		size := len(data)
+		if size > maxPacketSize {
+			size = maxPacketSize
+		}
+		packet := make([]byte, 4+size)
+		packet[0], packet[1], packet[2], packet[3] = byte(size), byte(size>>8), byte(size>>16), c.seq
+		copy(packet[4:], data[:size])
+		if _, err := c.nc.Write(packet); err != nil {
+			return err
+		}
+		c.seq++
+		data = data[size:]
+		if size < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// command 发送命令, 重置包序号.
+func (c *conn) command(cmd byte, arg []byte) error {
+	c.seq = 0
+	return c.writePacket(append([]byte{cmd}, arg...))
+}
+
+// readOK 读取 OK 包, ERR 包转换为错误.
+func (c *conn) readOK() error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch data[0] {
+	case 0x00:
+		return nil
+	case 0xff:
+		return parseErrPacket(data)
+	default:
+		return fmt.Errorf("cdc: unexpected packet 0x%02x", data[0])
+	}
+}
+
+// exec 执行无结果集的语句, 如 SET.
+func (c *conn) exec(query string) error {
+	if err := c.command(comQuery, []byte(query)); err != nil {
+		return err
+	}
+	return c.readOK()
+}
+
+// handshake 完成握手与认证, 支持 mysql_native_password 与 caching_sha2_password.
+func (c *conn) handshake(user, password string) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if data[0] == 0xff {
+		return parseErrPacket(data)
+	}
+	if data[0] != 10 {
+		return fmt.Errorf("cdc: unsupported protocol version %d", data[0])
+	}
+	pos := bytes.IndexByte(data[1:], 0) + 2 // 服务端版本
+	if pos < 2 || len(data) < pos+4+8+1+2 {
+		return errMalformedPacket
+	}
+	pos += 4 // connection id
+	scramble := append([]byte{}, data[pos:pos+8]...)
+	pos += 8 + 1
+	capability := uint32(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+	plugin := "mysql_native_password"
+	if len(data) > pos {
+		if len(data) < pos+16 {
+			return errMalformedPacket
+		}
+		pos += 1 + 2 // charset, status
+		capability |= uint32(binary.LittleEndian.Uint16(data[pos:])) << 16
+		pos += 2
+		authLen := int(data[pos])
+		pos += 1 + 10
+		if capability&clientSecureConnection != 0 {
+			n := authLen - 8
+			if n < 13 {
+				n = 13
+			}
+			if len(data) < pos+n {
+				return errMalformedPacket
+			}
+			scramble = append(scramble, data[pos:pos+n-1]...) // 去除结尾 NUL
+			pos += n
+		}
+		if capability&clientPluginAuth != 0 && len(data) > pos {
+			if end := bytes.IndexByte(data[pos:], 0); end >= 0 {
+				plugin = string(data[pos : pos+end])
+			} else {
+				plugin = string(data[pos:])
+			}
+		}
+	}
+	if capability&clientProtocol41 == 0 {
+		return errors.New("cdc: server does not support protocol 41")
+	}
+
+	authResp, err := scrambleAuth(plugin, scramble, password)
+	if err != nil {
+		return err
+	}
+	flags := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth)
+	resp := make([]byte, 32, 32+len(user)+len(authResp)+len(plugin)+3)
+	binary.LittleEndian.PutUint32(resp, flags)
+	binary.LittleEndian.PutUint32(resp[4:], maxPacketSize)
+	resp[8] = 45 // utf8mb4_general_ci
+	resp = append(resp, user...)
+	resp = append(resp, 0, byte(len(authResp)))
+	resp = append(resp, authResp...)
+	resp = append(resp, plugin...)
+	resp = append(resp, 0)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.authResult(plugin, scramble, password)
+}
+
+func (c *conn) authResult(plugin string, scramble []byte, password string) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		switch data[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseErrPacket(data)
+		case 0xfe: // 切换认证插件
+			end := bytes.IndexByte(data[1:], 0)
+			if end < 0 {
+				return errMalformedPacket
+			}
+			plugin = string(data[1 : 1+end])
+			scramble = bytes.TrimRight(data[2+end:], "\x00")
+			resp, err := scrambleAuth(plugin, scramble, password)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(resp); err != nil {
+				return err
+			}
+		case 0x01: // caching_sha2_password 后续数据
+			if plugin != "caching_sha2_password" || len(data) < 2 {
+				return errMalformedPacket
+			}
+			switch data[1] {
+			case 3: // 快速认证成功, 等待 OK
+			case 4: // 完整认证, 非 TLS 连接使用服务端公钥加密密码
+				if err := c.writePacket([]byte{2}); err != nil {
+					return err
+				}
+				key, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if key[0] == 0xff {
+					return parseErrPacket(key)
+				}
+				enc, err := encryptPassword(key[1:], scramble, password)
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(enc); err != nil {
+					return err
+				}
+			default:
+				return errMalformedPacket
+			}
+		default:
+			return fmt.Errorf("cdc: unexpected auth packet 0x%02x", data[0])
+		}
+	}
+}
+
+func scrambleAuth(plugin string, scramble []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(scramble) < 20 {
+		return nil, errMalformedPacket
+	}
+	switch plugin {
+	case "mysql_native_password":
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		h1 := sha1.Sum([]byte(password))
+		h2 := sha1.Sum(h1[:])
+		h := sha1.New()
+		h.Write(scramble[:20])
+		h.Write(h2[:])
+		h3 := h.Sum(nil)
+		for i := range h3 {
+			h3[i] ^= h1[i]
+		}
+		return h3, nil
+	case "caching_sha2_password":
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h1 := sha256.Sum256([]byte(password))
+		h2 := sha256.Sum256(h1[:])
+		h := sha256.New()
+		h.Write(h2[:])
+		h.Write(scramble[:20])
+		h3 := h.Sum(nil)
+		for i := range h3 {
+			h3[i] ^= h1[i]
+		}
+		return h3, nil
+	default:
+		return nil, fmt.Errorf("cdc: unsupported auth plugin %s", plugin)
+	}
+}
+
+func encryptPassword(pemKey, scramble []byte, password string) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("cdc: invalid server public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("cdc: server public key is not rsa")
+	}
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaPub, plain, nil)
+}
+
+// registerSlave 注册为从库, 出现在 SHOW REPLICAS 中.
+func (c *conn) registerSlave(serverID uint32, user, password string) error {
+	hostname := "driver-cdc"
+	arg := make([]byte, 0, 18+len(hostname)+len(user)+len(password))
+	arg = binary.LittleEndian.AppendUint32(arg, serverID)
+	arg = append(arg, byte(len(hostname)))
+	arg = append(arg, hostname...)
+	arg = append(arg, byte(len(user)))
+	arg = append(arg, user...)
+	arg = append(arg, byte(len(password)))
+	arg = append(arg, password...)
+	arg = binary.LittleEndian.AppendUint16(arg, 0) // port
+	arg = binary.LittleEndian.AppendUint32(arg, 0) // replication rank
+	arg = binary.LittleEndian.AppendUint32(arg, 0) // master id
+	if err := c.command(comRegisterSlave, arg); err != nil {
+		return err
+	}
+	return c.readOK()
+}
+
+// binlogDump 请求从位点开始推送 binlog.
+func (c *conn) binlogDump(serverID uint32, pos Position) error {
+	arg := make([]byte, 0, 10+len(pos.File))
+	arg = binary.LittleEndian.AppendUint32(arg, pos.Pos)
+	arg = binary.LittleEndian.AppendUint16(arg, 0) // flags, 阻塞等待新事件
+	arg = binary.LittleEndian.AppendUint32(arg, serverID)
+	arg = append(arg, pos.File...)
+	return c.command(comBinlogDump, arg)
+}
+
+// readEvent 读取一个 binlog 事件, 含事件头.
+func (c *conn) readEvent() ([]byte, error) {
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch data[0] {
+	case 0x00:
+		return data[1:], nil
+	case 0xff:
+		return nil, parseErrPacket(data)
+	case 0xfe:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("cdc: unexpected binlog packet 0x%02x", data[0])
+	}
+}
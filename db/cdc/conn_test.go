@@ -0,0 +1,308 @@
+package cdc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// 测试向量与 github.com/go-sql-driver/mysql 的认证测试一致.
+func TestScrambleAuth(t *testing.T) {
+	tests := []struct {
+		plugin   string
+		scramble []byte
+		password string
+		want     []byte
+	}{
+		{
+			plugin:   "mysql_native_password",
+			scramble: []byte{70, 114, 92, 94, 1, 38, 11, 116, 63, 114, 23, 101, 126, 103, 26, 95, 81, 17, 24, 21},
+			password: "secret",
+			want:     []byte{53, 177, 140, 159, 251, 189, 127, 53, 109, 252, 172, 50, 211, 192, 240, 164, 26, 48, 207, 45},
+		},
+		{
+			plugin:   "caching_sha2_password",
+			scramble: []byte{90, 105, 74, 126, 30, 48, 37, 56, 3, 23, 115, 127, 69, 22, 41, 84, 32, 123, 43, 118},
+			password: "secret",
+			want: []byte{102, 32, 5, 35, 143, 161, 140, 241, 171, 232, 56, 139, 43, 14, 107, 196, 249, 170, 147, 60,
+				220, 204, 120, 178, 214, 15, 184, 150, 26, 61, 57, 235},
+		},
+		{
+			plugin:   "caching_sha2_password",
+			scramble: []byte{90, 105, 74, 126, 30, 48, 37, 56, 3, 23, 115, 127, 69, 22, 41, 84, 32, 123, 43, 118},
+		},
+	}
+	for _, tt := range tests {
+		got, err := scrambleAuth(tt.plugin, tt.scramble, tt.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s %q: got %v, want %v", tt.plugin, tt.password, got, tt.want)
+		}
+	}
+
+	if _, err := scrambleAuth("sha256_password", make([]byte, 20), "secret"); err == nil {
+		t.Error("unsupported plugin accepted")
+	}
+	if _, err := scrambleAuth("mysql_native_password", make([]byte, 8), "secret"); !errors.Is(err, errMalformedPacket) {
+		t.Errorf("short scramble: got %v, want errMalformedPacket", err)
+	}
+}
+
+var testScramble = []byte("abcdefghijklmnopqrst")
+
+// fakeServer 模拟 MySQL 服务端握手, 复用 conn 的分包读写.
+type fakeServer struct {
+	*conn
+}
+
+// greeting 发送 v10 握手包.
+func (s *fakeServer) greeting(plugin string) error {
+	data := []byte{10}
+	data = append(data, "8.0.36"...)
+	data = append(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, 1) // connection id
+	data = append(data, testScramble[:8]...)
+	data = append(data, 0)
+	capability := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth)
+	data = binary.LittleEndian.AppendUint16(data, uint16(capability))
+	data = append(data, 45)
+	data = binary.LittleEndian.AppendUint16(data, 2) // status
+	data = binary.LittleEndian.AppendUint16(data, uint16(capability>>16))
+	data = append(data, byte(len(testScramble)+1))
+	data = append(data, make([]byte, 10)...)
+	data = append(data, testScramble[8:]...)
+	data = append(data, 0)
+	data = append(data, plugin...)
+	data = append(data, 0)
+	return s.writePacket(data)
+}
+
+// response 读取握手响应, 返回用户、认证数据与插件.
+func (s *fakeServer) response() (user string, auth []byte, plugin string, err error) {
+	data, err := s.readPacket()
+	if err != nil {
+		return "", nil, "", err
+	}
+	if len(data) < 33 {
+		return "", nil, "", errMalformedPacket
+	}
+	if flags := binary.LittleEndian.Uint32(data); flags&clientProtocol41 == 0 || flags&clientPluginAuth == 0 {
+		return "", nil, "", fmt.Errorf("unexpected client flags 0x%x", flags)
+	}
+	data = data[32:]
+	end := bytes.IndexByte(data, 0)
+	user, data = string(data[:end]), data[end+1:]
+	n := int(data[0])
+	auth, data = data[1:1+n], data[1+n:]
+	plugin = string(bytes.TrimRight(data, "\x00"))
+	return user, auth, plugin, nil
+}
+
+func (s *fakeServer) ok() error {
+	return s.writePacket([]byte{0x00, 0, 0, 2, 0, 0, 0})
+}
+
+func (s *fakeServer) expectAuth(auth []byte, plugin, password string) error {
+	want, _ := scrambleAuth(plugin, testScramble, password)
+	if !bytes.Equal(auth, want) {
+		return fmt.Errorf("%s auth %v, want %v", plugin, auth, want)
+	}
+	return nil
+}
+
+func TestHandshake(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := []struct {
+		name    string
+		plugin  string
+		serve   func(s *fakeServer, auth []byte) error
+		wantErr error
+	}{
+		{
+			name:   "native password",
+			plugin: "mysql_native_password",
+			serve: func(s *fakeServer, auth []byte) error {
+				if err := s.expectAuth(auth, "mysql_native_password", "secret"); err != nil {
+					return err
+				}
+				return s.ok()
+			},
+		},
+		{
+			name:   "caching sha2 fast auth",
+			plugin: "caching_sha2_password",
+			serve: func(s *fakeServer, auth []byte) error {
+				if err := s.expectAuth(auth, "caching_sha2_password", "secret"); err != nil {
+					return err
+				}
+				if err := s.writePacket([]byte{0x01, 3}); err != nil {
+					return err
+				}
+				return s.ok()
+			},
+		},
+		{
+			name:   "caching sha2 full auth with rsa",
+			plugin: "caching_sha2_password",
+			serve: func(s *fakeServer, auth []byte) error {
+				if err := s.writePacket([]byte{0x01, 4}); err != nil {
+					return err
+				}
+				req, err := s.readPacket()
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(req, []byte{2}) {
+					return fmt.Errorf("public key request %v", req)
+				}
+				if err := s.writePacket(append([]byte{0x01}, pemKey...)); err != nil {
+					return err
+				}
+				enc, err := s.readPacket()
+				if err != nil {
+					return err
+				}
+				plain, err := rsa.DecryptOAEP(sha1.New(), nil, key, enc, nil)
+				if err != nil {
+					return err
+				}
+				for i := range plain {
+					plain[i] ^= testScramble[i%len(testScramble)]
+				}
+				if string(plain) != "secret\x00" {
+					return fmt.Errorf("decrypted password %q", plain)
+				}
+				return s.ok()
+			},
+		},
+		{
+			name:   "auth switch",
+			plugin: "caching_sha2_password",
+			serve: func(s *fakeServer, auth []byte) error {
+				req := append([]byte{0xfe}, "mysql_native_password"...)
+				req = append(req, 0)
+				req = append(req, testScramble...)
+				if err := s.writePacket(append(req, 0)); err != nil {
+					return err
+				}
+				resp, err := s.readPacket()
+				if err != nil {
+					return err
+				}
+				if err := s.expectAuth(resp, "mysql_native_password", "secret"); err != nil {
+					return err
+				}
+				return s.ok()
+			},
+		},
+		{
+			name:   "access denied",
+			plugin: "mysql_native_password",
+			serve: func(s *fakeServer, auth []byte) error {
+				return s.writePacket(append([]byte{0xff, 0x15, 0x04, '#'}, "28000Access denied"...))
+			},
+			wantErr: &serverError{Code: 1045, State: "28000", Message: "Access denied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				s := &fakeServer{conn: &conn{nc: server, br: bufio.NewReader(server)}}
+				if err := s.greeting(tt.plugin); err != nil {
+					done <- err
+					return
+				}
+				user, auth, plugin, err := s.response()
+				if err != nil {
+					done <- err
+					return
+				}
+				if user != "repl" || plugin != tt.plugin {
+					done <- fmt.Errorf("got user %q plugin %q", user, plugin)
+					return
+				}
+				done <- tt.serve(s, auth)
+			}()
+
+			c := &conn{nc: client, br: bufio.NewReader(client)}
+			err := c.handshake("repl", "secret")
+			if serr := <-done; serr != nil {
+				t.Fatalf("server: %v", serr)
+			}
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var got *serverError
+			if !errors.As(err, &got) || *got != *tt.wantErr.(*serverError) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHandshakeServerError(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		s := &conn{nc: server, br: bufio.NewReader(server)}
+		_ = s.writePacket(append([]byte{0xff, 0x10, 0x04}, "Too many connections"...))
+	}()
+	c := &conn{nc: client, br: bufio.NewReader(client)}
+	var got *serverError
+	if err := c.handshake("repl", "secret"); !errors.As(err, &got) || got.Code != 1040 {
+		t.Fatalf("got %v, want mysql error 1040", err)
+	}
+}
+
+func TestPacketSplit(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	payload := bytes.Repeat([]byte{7}, maxPacketSize+10)
+	go func() {
+		s := &conn{nc: server, br: bufio.NewReader(server)}
+		_ = s.writePacket(payload)
+	}()
+	c := &conn{nc: client, br: bufio.NewReader(client)}
+	got, err := c.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(payload))
+	}
+	if c.seq != 2 {
+		t.Fatalf("seq %d, want 2", c.seq)
+	}
+}
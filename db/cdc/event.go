@@ -0,0 +1,56 @@
+package cdc
+
+import (
+	"fmt"
+	"time"
+)
+
+// Operation 行变更类型.
+type Operation string
+
+const (
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// Position binlog 位点.
+type Position struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// Event 单行变更事件.
+//
+// 列值按 MySQL 类型解码:
+// 整数为 int64 或 uint64(无符号列), FLOAT/DOUBLE 为 float32/float64, DECIMAL 为字符串,
+// DATE/DATETIME/TIMESTAMP 为 time.Time, TIME 为 time.Duration, YEAR 为 int,
+// CHAR/VARCHAR/TEXT/ENUM/SET 为字符串, BINARY/BLOB/GEOMETRY 为 []byte, BIT 为 uint64,
+// JSON 为 json.RawMessage, NULL 为 nil.
+type Event struct {
+	// 所在事务提交后的位点, 同一事务内的事件相同.
+	Position Position
+	// 语句执行时间, 精度为秒.
+	Time   time.Time
+	Schema string
+	Table  string
+	Op     Operation
+	// 按表定义顺序的列名.
+	Columns []string
+	// 变更前的行, OpInsert 为 nil.
+	Before map[string]interface{}
+	// 变更后的行, OpDelete 为 nil.
+	After map[string]interface{}
+}
+
+// Row 返回变更后的行, 删除时返回变更前的行.
+func (e *Event) Row() map[string]interface{} {
+	if e.Op == OpDelete {
+		return e.Before
+	}
+	return e.After
+}
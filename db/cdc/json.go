@@ -0,0 +1,194 @@
+package cdc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// JSON 二进制格式的值类型.
+const (
+	jsonSmallObject = 0x00
+	jsonLargeObject = 0x01
+	jsonSmallArray  = 0x02
+	jsonLargeArray  = 0x03
+	jsonLiteral     = 0x04
+	jsonInt16       = 0x05
+	jsonUint16      = 0x06
+	jsonInt32       = 0x07
+	jsonUint32      = 0x08
+	jsonInt64       = 0x09
+	jsonUint64      = 0x0a
+	jsonDouble      = 0x0b
+	jsonString      = 0x0c
+	jsonOpaque      = 0x0f
+)
+
+const (
+	jsonLiteralNull  = 0x00
+	jsonLiteralTrue  = 0x01
+	jsonLiteralFalse = 0x02
+)
+
+// decodeJSON 解码 MySQL JSON 列的二进制格式.
+func decodeJSON(data []byte) (v interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, err = nil, fmt.Errorf("malformed json value: %v", r)
+		}
+	}()
+	return decodeJSONValue(data[0], data[1:])
+}
+
+func decodeJSONValue(typ byte, data []byte) (interface{}, error) {
+	switch typ {
+	case jsonSmallObject:
+		return decodeJSONContainer(data, false, true)
+	case jsonLargeObject:
+		return decodeJSONContainer(data, true, true)
+	case jsonSmallArray:
+		return decodeJSONContainer(data, false, false)
+	case jsonLargeArray:
+		return decodeJSONContainer(data, true, false)
+	case jsonLiteral:
+		switch data[0] {
+		case jsonLiteralNull:
+			return nil, nil
+		case jsonLiteralTrue:
+			return true, nil
+		case jsonLiteralFalse:
+			return false, nil
+		}
+		return nil, fmt.Errorf("unknown json literal 0x%02x", data[0])
+	case jsonInt16:
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case jsonUint16:
+		return uint64(binary.LittleEndian.Uint16(data)), nil
+	case jsonInt32:
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case jsonUint32:
+		return uint64(binary.LittleEndian.Uint32(data)), nil
+	case jsonInt64:
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case jsonUint64:
+		return binary.LittleEndian.Uint64(data), nil
+	case jsonDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case jsonString:
+		n, size := readJSONVarLen(data)
+		return string(data[size : size+n]), nil
+	case jsonOpaque:
+		return decodeJSONOpaque(data)
+	}
+	return nil, fmt.Errorf("unknown json type 0x%02x", typ)
+}
+
+// decodeJSONContainer 解码对象或数组, 偏移量相对于容器起始位置.
+func decodeJSONContainer(data []byte, large, object bool) (interface{}, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(pos int) int {
+		if large {
+			return int(binary.LittleEndian.Uint32(data[pos:]))
+		}
+		return int(binary.LittleEndian.Uint16(data[pos:]))
+	}
+
+	count := readOffset(0)
+	pos := 2 * offsetSize
+	keys := make([]string, 0, count)
+	if object {
+		for i := 0; i < count; i++ {
+			keyOffset := readOffset(pos)
+			keyLen := int(binary.LittleEndian.Uint16(data[pos+offsetSize:]))
+			keys = append(keys, string(data[keyOffset:keyOffset+keyLen]))
+			pos += offsetSize + 2
+		}
+	}
+
+	values := make([]interface{}, count)
+	for i := 0; i < count; i++ {
+		typ := data[pos]
+		var v interface{}
+		var err error
+		if jsonInlined(typ, large) {
+			v, err = decodeJSONValue(typ, data[pos+1:pos+1+offsetSize])
+		} else {
+			v, err = decodeJSONValue(typ, data[readOffset(pos+1):])
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		pos += 1 + offsetSize
+	}
+
+	if !object {
+		return values, nil
+	}
+	obj := make(map[string]interface{}, count)
+	for i, k := range keys {
+		obj[k] = values[i]
+	}
+	return obj, nil
+}
+
+// jsonInlined 判断值是否直接存储在值条目中.
+func jsonInlined(typ byte, large bool) bool {
+	switch typ {
+	case jsonLiteral, jsonInt16, jsonUint16:
+		return true
+	case jsonInt32, jsonUint32:
+		return large
+	}
+	return false
+}
+
+// readJSONVarLen 读取变长长度, 每字节低 7 位有效.
+func readJSONVarLen(data []byte) (int, int) {
+	var n int
+	for i := 0; i < 5; i++ {
+		n |= int(data[i]&0x7f) << (7 * i)
+		if data[i]&0x80 == 0 {
+			return n, i + 1
+		}
+	}
+	panic("json variable length too long")
+}
+
+// decodeJSONOpaque 解码 DECIMAL、日期时间等非 JSON 原生类型.
+func decodeJSONOpaque(data []byte) (interface{}, error) {
+	typ := data[0]
+	n, size := readJSONVarLen(data[1:])
+	raw := data[1+size : 1+size+n]
+	switch typ {
+	case typeNewDecimal:
+		v, _, err := decodeDecimal(raw[2:], int(raw[0]), int(raw[1]))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(v.(string)), nil
+	case typeDate, typeDateTime, typeTimestamp:
+		packed := int64(binary.LittleEndian.Uint64(raw))
+		ymdhms, micro := packed>>24, packed&(1<<24-1)
+		ymd, hms := ymdhms>>17, ymdhms&(1<<17-1)
+		ym := ymd >> 5
+		date := fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd&31)
+		if typ == typeDate {
+			return date, nil
+		}
+		return fmt.Sprintf("%s %02d:%02d:%02d.%06d", date, hms>>12, hms>>6&63, hms&63, micro), nil
+	case typeTime:
+		d := packedTime(int64(binary.LittleEndian.Uint64(raw)))
+		sign := ""
+		if d < 0 {
+			sign, d = "-", -d
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, int64(d.Hours()), int64(d.Minutes())%60, int64(d.Seconds())%60, d.Microseconds()%1000000), nil
+	}
+	return "base64:type" + fmt.Sprint(typ) + ":" + base64.StdEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,422 @@
+// Package cdc 实现基于 MySQL binlog 的变更数据捕获.
+//
+// 监听 RWOptions.Write 的行格式(binlog_format=ROW) binlog, 将监听表的插入、更新、删除解码为 Event,
+// 按事务投递到 Sink, 投递成功后保存检查点. 用于缓存失效、搜索索引等, 避免业务双写.
+//
+// 连接账号需要 REPLICATION SLAVE、REPLICATION CLIENT 权限, 及 information_schema 的查询权限.
+// 建议开启 binlog_row_metadata=FULL, 列名与 ENUM/SET 取值直接从 binlog 读取.
+//
+// 复制协议由本包自行实现(conn.go, binlog.go), 只覆盖 ROW 格式所需的事件与认证方式
+// (mysql_native_password、caching_sha2_password), 避免引入 go-mysql 及其 pingcap 依赖树.
+// 不支持 TLS, 使用 caching_sha2_password 完整认证时密码经服务端公钥 RSA 加密传输.
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tp-life/driver/db"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrNotRowFormat       = errors.New("cdc: binlog_format is not ROW")
+	ErrServerIDRequired   = errors.New("cdc: server id required")
+	ErrPartialJSONUpdates = errors.New("cdc: partial json updates not supported, set binlog_row_value_options=''")
+)
+
+// checkpointInterval 无监听表变更时保存检查点的最小间隔.
+const checkpointInterval = 5 * time.Second
+
+// Options 监听配置.
+type Options struct {
+	// 复制拓扑内唯一的 server_id, 不可与主从库及其他监听重复.
+	ServerID uint32
+	// 监听的表, 格式为 库.表, 或只写表名使用 Write.Database. 为空监听 Write.Database 全部表.
+	Tables []string
+	// 事件投递目标, 按顺序投递, 任一返回错误时重连并从检查点重新投递.
+	Sinks []Sink
+	// 检查点, 默认 NewMemoryCheckpoint(). 无检查点时从当前位点开始.
+	Checkpoint Checkpointer
+	// 心跳间隔, 默认 30 秒. 超过两个心跳间隔未收到数据时重连.
+	Heartbeat time.Duration
+	// 重连间隔, 默认 1 秒, 连续失败时翻倍, 最大 1 分钟.
+	RetryInterval time.Duration
+	// DATETIME/TIMESTAMP 列的时区, 默认 time.Local.
+	Location *time.Location
+	// 为 nil 使用 slog.Default().
+	Logger *slog.Logger
+}
+
+// Listener binlog 监听.
+type Listener struct {
+	opts   Options
+	dbOpts *db.Options
+	tables map[string]bool
+	schema string
+	meta   *metaResolver
+	sqlDB  *sql.DB
+}
+
+// New 创建监听, 不会立即建立连接.
+func New(rw *db.RWOptions, opts Options) (*Listener, error) {
+	if rw == nil || rw.Write == nil {
+		return nil, db.ErrWriteDBNotConfigured
+	}
+	if opts.ServerID == 0 {
+		return nil, ErrServerIDRequired
+	}
+	if opts.Checkpoint == nil {
+		opts.Checkpoint = NewMemoryCheckpoint()
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = 30 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	sqlDB, err := sql.Open("mysql", db.NewMysqlDBOpener().DSN(rw.Write))
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(2)
+	l := &Listener{
+		opts:   opts,
+		dbOpts: rw.Write,
+		tables: make(map[string]bool, len(opts.Tables)),
+		schema: rw.Write.Database,
+		meta:   newMetaResolver(sqlDB),
+		sqlDB:  sqlDB,
+	}
+	for _, table := range opts.Tables {
+		if !strings.Contains(table, ".") {
+			table = rw.Write.Database + "." + table
+		}
+		l.tables[table] = true
+	}
+	return l, nil
+}
+
+// Close 释放元数据查询连接.
+func (l *Listener) Close() error {
+	return l.sqlDB.Close()
+}
+
+// watched 判断是否监听表.
+func (l *Listener) watched(schema, table string) bool {
+	if len(l.tables) == 0 {
+		return schema == l.schema
+	}
+	return l.tables[schema+"."+table]
+}
+
+// Run 持续监听直至 ctx 取消, 出错时按 RetryInterval 退避重连.
+func (l *Listener) Run(ctx context.Context) error {
+	retry := l.opts.RetryInterval
+	for {
+		err := l.run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrNotRowFormat) || errors.Is(err, ErrPartialJSONUpdates) {
+			return err
+		}
+		l.opts.Logger.WarnContext(ctx, "cdc stream interrupted", slog.Any("scene", "cdc"), slog.Any("err", err), slog.Any("retry", retry))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		if retry *= 2; retry > time.Minute {
+			retry = time.Minute
+		}
+	}
+}
+
+func (l *Listener) run(ctx context.Context) error {
+	var format string
+	if err := l.sqlDB.QueryRowContext(ctx, "SELECT @@global.binlog_format").Scan(&format); err != nil {
+		return err
+	}
+	if !strings.EqualFold(format, "ROW") {
+		return fmt.Errorf("%w: %s", ErrNotRowFormat, format)
+	}
+
+	pos, err := l.opts.Checkpoint.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if pos == nil {
+		if pos, err = l.currentPosition(ctx); err != nil {
+			return err
+		}
+	}
+
+	addr := net.JoinHostPort(l.dbOpts.Host, strconv.Itoa(l.dbOpts.Port))
+	c, err := dial(ctx, addr, time.Duration(l.dbOpts.Timeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	if err := c.handshake(l.dbOpts.User, l.dbOpts.Password); err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"SET @master_binlog_checksum = @@global.binlog_checksum",
+		fmt.Sprintf("SET @master_heartbeat_period = %d", l.opts.Heartbeat.Nanoseconds()),
+	} {
+		if err := c.exec(query); err != nil {
+			return err
+		}
+	}
+	if err := c.registerSlave(l.opts.ServerID, l.dbOpts.User, l.dbOpts.Password); err != nil {
+		return err
+	}
+	if err := c.binlogDump(l.opts.ServerID, *pos); err != nil {
+		return err
+	}
+	l.opts.Logger.InfoContext(ctx, "cdc stream started", slog.Any("scene", "cdc"), slog.Any("position", pos.String()))
+
+	next := func() ([]byte, error) {
+		if err := c.nc.SetReadDeadline(time.Now().Add(2 * l.opts.Heartbeat)); err != nil {
+			return nil, err
+		}
+		return c.readEvent()
+	}
+	return l.stream(ctx, next, *pos, true)
+}
+
+// currentPosition 查询主库当前位点, 8.4 起使用 SHOW BINARY LOG STATUS.
+func (l *Listener) currentPosition(ctx context.Context) (*Position, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	for _, query := range []string{"SHOW BINARY LOG STATUS", "SHOW MASTER STATUS"} {
+		if rows, err = l.sqlDB.QueryContext(ctx, query); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("cdc: binary log is not enabled")
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	pos, err := strconv.ParseUint(string(values[1]), 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &Position{File: string(values[0]), Pos: uint32(pos)}, nil
+}
+
+// Replay 从本地 binlog 文件读取事件并投递, 不保存检查点.
+//
+// 用于测试与数据修复, r 为 mysqlbinlog 可读取的 binlog 文件, file 为位点中的文件名.
+func (l *Listener) Replay(ctx context.Context, r io.Reader, file string) error {
+	magic := make([]byte, len(binlogMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if string(magic) != string(binlogMagic) {
+		return errors.New("cdc: not a binlog file")
+	}
+	next := func() ([]byte, error) {
+		header := make([]byte, eventHeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		size := int(uint32(header[9]) | uint32(header[10])<<8 | uint32(header[11])<<16 | uint32(header[12])<<24)
+		if size < eventHeaderSize {
+			return nil, errMalformedEvent
+		}
+		data := make([]byte, size)
+		copy(data, header)
+		if _, err := io.ReadFull(r, data[eventHeaderSize:]); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	err := l.stream(ctx, next, Position{File: file, Pos: uint32(len(binlogMagic))}, false)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// stream 解析事件, 在事务提交时投递并保存检查点.
+func (l *Listener) stream(ctx context.Context, next func() ([]byte, error), pos Position, checkpoint bool) error {
+	p := newParser()
+	dec := &decoder{loc: l.opts.Location}
+	var (
+		pending  []*Event
+		lastSave = time.Now()
+	)
+	commit := func() error {
+		if len(pending) > 0 {
+			for _, e := range pending {
+				e.Position = pos
+			}
+			for _, sink := range l.opts.Sinks {
+				if err := sink.Handle(ctx, pending); err != nil {
+					return fmt.Errorf("cdc: sink at %s: %w", pos, err)
+				}
+			}
+		}
+		if checkpoint && (len(pending) > 0 || time.Since(lastSave) >= checkpointInterval) {
+			if err := l.opts.Checkpoint.Save(ctx, pos); err != nil {
+				return err
+			}
+			lastSave = time.Now()
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, err := next()
+		if err != nil {
+			return err
+		}
+		h, body, err := p.parse(data)
+		if err != nil {
+			return err
+		}
+		if h.Type == rotateEvent {
+			if pos, err = parseRotate(body); err != nil {
+				return err
+			}
+			continue
+		}
+		if h.LogPos > 0 && h.Type != heartbeatEvent {
+			pos.Pos = h.LogPos
+		}
+
+		switch h.Type {
+		case tableMapEvent:
+			t, err := parseTableMap(body)
+			if err != nil {
+				return err
+			}
+			if l.watched(t.schema, t.table) {
+				if err := l.meta.fill(ctx, t); err != nil {
+					l.opts.Logger.WarnContext(ctx, "cdc column metadata incomplete", slog.Any("scene", "cdc"), slog.Any("err", err))
+				}
+			}
+			p.tables[t.id] = t
+		case writeRowsEventV1, updateRowsEventV1, deleteRowsEventV1, writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2:
+			t, err := p.tableOf(body)
+			if err != nil {
+				return err
+			}
+			if !l.watched(t.schema, t.table) {
+				continue
+			}
+			e, err := p.parseRows(h.Type, body, t, dec)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, toEvents(e, time.Unix(int64(h.Timestamp), 0))...)
+		case partialUpdateRowsEvent:
+			t, err := p.tableOf(body)
+			if err != nil {
+				return err
+			}
+			if l.watched(t.schema, t.table) {
+				return ErrPartialJSONUpdates
+			}
+		case xidEvent:
+			if err := commit(); err != nil {
+				return err
+			}
+		case queryEvent:
+			_, query, err := parseQuery(body)
+			if err != nil {
+				return err
+			}
+			switch strings.ToUpper(strings.TrimSpace(query)) {
+			case "BEGIN":
+			case "COMMIT":
+				// 非事务引擎
+				if err := commit(); err != nil {
+					return err
+				}
+			default:
+				// DDL 隐式提交, 清除表结构缓存
+				l.meta.invalidate()
+				if err := commit(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// toEvents 转换行事件为单行事件.
+func toEvents(e *rowsEvent, ts time.Time) []*Event {
+	names := e.table.names()
+	events := make([]*Event, 0, len(e.rows))
+	for _, row := range e.rows {
+		events = append(events, &Event{
+			Time:    ts,
+			Schema:  e.table.schema,
+			Table:   e.table.table,
+			Op:      e.op,
+			Columns: names,
+			Before:  rowMap(names, row[0]),
+			After:   rowMap(names, row[1]),
+		})
+	}
+	return events
+}
+
+func rowMap(names []string, values []interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	m := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		if _, ok := v.(absent); !ok {
+			m[names[i]] = v
+		}
+	}
+	return m
+}
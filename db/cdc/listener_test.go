@@ -0,0 +1,328 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testTimestamp = 1700000000
+	testTableID   = 7
+	testFile      = "binlog.000001"
+)
+
+// rawEvent 构造的事件及其在文件中的起始位置.
+type rawEvent struct {
+	start uint32
+	data  []byte
+}
+
+// binlogWriter 按 MySQL 8.0 默认设置(binlog_checksum=CRC32)构造 binlog 事件.
+type binlogWriter struct {
+	pos    uint32
+	events []rawEvent
+}
+
+func newBinlogWriter() *binlogWriter {
+	w := &binlogWriter{pos: uint32(len(binlogMagic))}
+	w.formatDescription()
+	return w
+}
+
+// event 追加事件, 返回下一事件的位置.
+func (w *binlogWriter) event(typ byte, body []byte) uint32 {
+	start := w.pos
+	w.pos += uint32(eventHeaderSize + len(body) + 4)
+	w.events = append(w.events, rawEvent{start: start, data: encodeEvent(typ, body, w.pos, true)})
+	return w.pos
+}
+
+func encodeEvent(typ byte, body []byte, logPos uint32, checksum bool) []byte {
+	size := eventHeaderSize + len(body)
+	if checksum {
+		size += 4
+	}
+	data := make([]byte, eventHeaderSize, size)
+	binary.LittleEndian.PutUint32(data, testTimestamp)
+	data[4] = typ
+	binary.LittleEndian.PutUint32(data[5:], 1)
+	binary.LittleEndian.PutUint32(data[9:], uint32(size))
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	data = append(data, body...)
+	if checksum {
+		data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+	return data
+}
+
+func (w *binlogWriter) formatDescription() {
+	body := []byte{4, 0}
+	version := make([]byte, 50)
+	copy(version, "8.0.36")
+	body = append(body, version...)
+	body = append(body, 0, 0, 0, 0, eventHeaderSize)
+	body = append(body, make([]byte, 40)...) // post-header 长度
+	body = append(body, 1)                   // BINLOG_CHECKSUM_ALG_CRC32
+	w.event(formatDescriptionEvent, body)
+}
+
+// tableMap 写入 shop.items(id BIGINT, name VARCHAR(255) NULL) 的表映射, 包含 FULL 元数据.
+func (w *binlogWriter) tableMap(id uint64, schema, table string) {
+	body := tableIDBytes(id)
+	body = append(body, 0, 0)
+	body = append(body, byte(len(schema)))
+	body = append(body, schema...)
+	body = append(body, 0, byte(len(table)))
+	body = append(body, table...)
+	body = append(body, 0)
+	body = append(body, 2, typeLongLong, typeVarchar)
+	body = append(body, 2, 255, 0) // VARCHAR(255) 元数据
+	body = append(body, 0b10)      // name 可为 NULL
+	body = append(body, metaSignedness, 1, 0)
+	body = append(body, metaColumnName, 8, 2, 'i', 'd', 4, 'n', 'a', 'm', 'e')
+	body = append(body, metaDefaultCharset, 1, 33)
+	w.event(tableMapEvent, body)
+}
+
+type testRow struct {
+	id   int64
+	name string
+}
+
+func (r testRow) encode() []byte {
+	data := []byte{0} // NULL 位图
+	data = binary.LittleEndian.AppendUint64(data, uint64(r.id))
+	data = append(data, byte(len(r.name)))
+	return append(data, r.name...)
+}
+
+// rows 写入 v2 行事件, UPDATE 的 rows 按变更前、变更后交替排列.
+func (w *binlogWriter) rows(typ byte, id uint64, rows ...testRow) {
+	body := tableIDBytes(id)
+	body = append(body, 0, 0, 2, 0, 2, 0b11)
+	if typ == updateRowsEventV2 {
+		body = append(body, 0b11)
+	}
+	for _, r := range rows {
+		body = append(body, r.encode()...)
+	}
+	w.event(typ, body)
+}
+
+func (w *binlogWriter) query(query string) {
+	body := make([]byte, 13)
+	body[8] = 4 // 库名长度
+	body = append(body, "shop"...)
+	body = append(body, 0)
+	w.event(queryEvent, append(body, query...))
+}
+
+// transaction 写入 BEGIN、表映射、行事件与 XID, 返回事务提交后的位置.
+func (w *binlogWriter) transaction(typ byte, rows ...testRow) uint32 {
+	w.query("BEGIN")
+	w.tableMap(testTableID, "shop", "items")
+	w.rows(typ, testTableID, rows...)
+	return w.event(xidEvent, make([]byte, 8))
+}
+
+// file 返回 binlog 文件内容.
+func (w *binlogWriter) file() io.Reader {
+	buf := bytes.NewBuffer(append([]byte(nil), binlogMagic...))
+	for _, e := range w.events {
+		buf.Write(e.data)
+	}
+	return buf
+}
+
+// dump 模拟主库从 pos 开始的 binlog 推送: 人工 ROTATE、FORMAT_DESCRIPTION 及 pos 之后的事件.
+func (w *binlogWriter) dump(pos Position) func() ([]byte, error) {
+	rotate := binary.LittleEndian.AppendUint64(nil, uint64(pos.Pos))
+	events := [][]byte{encodeEvent(rotateEvent, append(rotate, pos.File...), 0, true), w.events[0].data}
+	for _, e := range w.events[1:] {
+		if e.start >= pos.Pos {
+			events = append(events, e.data)
+		}
+	}
+	return func() ([]byte, error) {
+		if len(events) == 0 {
+			return nil, io.EOF
+		}
+		data := events[0]
+		events = events[1:]
+		return data, nil
+	}
+}
+
+func tableIDBytes(id uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, id)[:6]
+}
+
+func newTestListener(sinks ...Sink) *Listener {
+	return &Listener{
+		opts: Options{
+			Sinks:      sinks,
+			Checkpoint: NewMemoryCheckpoint(),
+			Location:   time.UTC,
+			Logger:     slog.Default(),
+		},
+		tables: map[string]bool{"shop.items": true},
+		meta:   newMetaResolver(nil),
+	}
+}
+
+// recorder 记录每次投递的事件.
+type recorder struct {
+	batches [][]*Event
+	// 第 failAt 次投递返回错误, 从 1 开始, 0 不失败.
+	failAt int
+	calls  int
+}
+
+func (r *recorder) Handle(ctx context.Context, events []*Event) error {
+	r.calls++
+	if r.calls == r.failAt {
+		return errors.New("sink unavailable")
+	}
+	r.batches = append(r.batches, append([]*Event(nil), events...))
+	return nil
+}
+
+func TestReplayRowsEvents(t *testing.T) {
+	w := newBinlogWriter()
+	insertPos := w.transaction(writeRowsEventV2, testRow{1, "a"}, testRow{2, "b"})
+	updatePos := w.transaction(updateRowsEventV2, testRow{1, "a"}, testRow{1, "a2"}, testRow{2, "b"}, testRow{3, "b2"})
+	// 未监听的表不投递.
+	w.query("BEGIN")
+	w.tableMap(8, "shop", "logs")
+	w.rows(writeRowsEventV2, 8, testRow{9, "x"})
+	w.event(xidEvent, make([]byte, 8))
+	deletePos := w.transaction(deleteRowsEventV2, testRow{2, "b"})
+
+	rec := &recorder{}
+	if err := newTestListener(rec).Replay(context.Background(), w.file(), testFile); err != nil {
+		t.Fatal(err)
+	}
+
+	row := func(id int64, name string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "name": name}
+	}
+	want := [][]*Event{
+		{
+			{Position: Position{testFile, insertPos}, Op: OpInsert, After: row(1, "a")},
+			{Position: Position{testFile, insertPos}, Op: OpInsert, After: row(2, "b")},
+		},
+		{
+			{Position: Position{testFile, updatePos}, Op: OpUpdate, Before: row(1, "a"), After: row(1, "a2")},
+			{Position: Position{testFile, updatePos}, Op: OpUpdate, Before: row(2, "b"), After: row(3, "b2")},
+		},
+		{
+			{Position: Position{testFile, deletePos}, Op: OpDelete, Before: row(2, "b")},
+		},
+	}
+	for _, batch := range want {
+		for _, e := range batch {
+			e.Time = time.Unix(testTimestamp, 0)
+			e.Schema, e.Table = "shop", "items"
+			e.Columns = []string{"id", "name"}
+		}
+	}
+	if len(rec.batches) != len(want) {
+		t.Fatalf("got %d batches, want %d", len(rec.batches), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(rec.batches[i], want[i]) {
+			t.Errorf("batch %d:\ngot  %s\nwant %s", i, formatEvents(rec.batches[i]), formatEvents(want[i]))
+		}
+	}
+}
+
+func TestReplayChecksumMismatch(t *testing.T) {
+	w := newBinlogWriter()
+	w.transaction(writeRowsEventV2, testRow{1, "a"})
+	last := w.events[len(w.events)-1].data
+	last[len(last)-1] ^= 0xff
+
+	err := newTestListener().Replay(context.Background(), w.file(), testFile)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("got %v, want checksum mismatch", err)
+	}
+}
+
+func TestParseFakeRotate(t *testing.T) {
+	body := binary.LittleEndian.AppendUint64(nil, 4)
+	body = append(body, "binlog.000042"...)
+	want := Position{File: "binlog.000042", Pos: 4}
+
+	for _, checksum := range []bool{true, false} {
+		p := newParser()
+		h, rotate, err := p.parse(encodeEvent(rotateEvent, body, 0, checksum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Type != rotateEvent {
+			t.Fatalf("got type %d, want rotate", h.Type)
+		}
+		got, err := parseRotate(rotate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("checksum %v: got %s, want %s", checksum, got, want)
+		}
+	}
+}
+
+func TestStreamCheckpointResume(t *testing.T) {
+	w := newBinlogWriter()
+	firstPos := w.transaction(writeRowsEventV2, testRow{1, "a"})
+	secondPos := w.transaction(writeRowsEventV2, testRow{2, "b"})
+
+	ctx := context.Background()
+	rec := &recorder{failAt: 2}
+	l := newTestListener(rec)
+	start := Position{File: testFile, Pos: uint32(len(binlogMagic))}
+	if err := l.stream(ctx, w.dump(start), start, true); err == nil || !strings.Contains(err.Error(), "sink unavailable") {
+		t.Fatalf("got %v, want sink error", err)
+	}
+	pos, err := l.opts.Checkpoint.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Position{File: testFile, Pos: firstPos}); pos == nil || *pos != want {
+		t.Fatalf("checkpoint %v, want %s", pos, want)
+	}
+
+	// 从检查点重连, 已投递的事务不重复投递.
+	if err := l.stream(ctx, w.dump(*pos), *pos, true); !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v, want EOF", err)
+	}
+	if len(rec.batches) != 2 {
+		t.Fatalf("got %d batches, want 2", len(rec.batches))
+	}
+	for i, id := range []int64{1, 2} {
+		if got := rec.batches[i][0].After["id"]; got != id {
+			t.Errorf("batch %d id %v, want %d", i, got, id)
+		}
+	}
+	if pos, _ = l.opts.Checkpoint.Load(ctx); *pos != (Position{File: testFile, Pos: secondPos}) {
+		t.Errorf("checkpoint %s, want %s:%d", pos, testFile, secondPos)
+	}
+}
+
+func formatEvents(events []*Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&b, "%s %s %v -> %v; ", e.Position, e.Op, e.Before, e.After)
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package cdc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// columnMeta information_schema 中的列定义.
+type columnMeta struct {
+	name       string
+	dataType   string
+	columnType string
+}
+
+// metaResolver 补充 TABLE_MAP_EVENT 缺失的列名、符号、字符集与 ENUM/SET 取值.
+//
+// binlog_row_metadata=FULL 时无需查询. 否则查询的是当前表结构,
+// 回放 DDL 之前的事件可能不一致, 列数不一致时保留 @1、@2... 列名.
+type metaResolver struct {
+	sqlDB *sql.DB
+
+	mut   sync.Mutex
+	cache map[string][]columnMeta
+}
+
+func newMetaResolver(sqlDB *sql.DB) *metaResolver {
+	return &metaResolver{sqlDB: sqlDB, cache: make(map[string][]columnMeta)}
+}
+
+// fill 补充表映射的列信息.
+func (r *metaResolver) fill(ctx context.Context, t *tableMap) error {
+	if t.hasNames && t.hasSign && t.hasCharset && (t.hasEnumVals || !hasEnumOrSet(t)) {
+		return nil
+	}
+	if r.sqlDB == nil {
+		return fmt.Errorf("cdc: %s.%s column metadata incomplete, set binlog_row_metadata=FULL", t.schema, t.table)
+	}
+	columns, err := r.columns(ctx, t.schema, t.table)
+	if err != nil {
+		return err
+	}
+	if len(columns) != len(t.columns) {
+		return fmt.Errorf("cdc: %s.%s has %d columns, binlog has %d", t.schema, t.table, len(columns), len(t.columns))
+	}
+	for i, c := range t.columns {
+		m := columns[i]
+		if !t.hasNames {
+			c.name = m.name
+		}
+		if !t.hasSign {
+			c.unsigned = strings.Contains(strings.ToLower(m.columnType), "unsigned")
+		}
+		if !t.hasCharset {
+			switch m.dataType {
+			case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+				c.binary = true
+			}
+		}
+		if !t.hasEnumVals && (c.typ == typeEnum || c.typ == typeSet) {
+			c.values = parseEnumValues(m.columnType)
+		}
+	}
+	return nil
+}
+
+func (r *metaResolver) columns(ctx context.Context, schema, table string) ([]columnMeta, error) {
+	key := schema + "." + table
+	r.mut.Lock()
+	columns, ok := r.cache[key]
+	r.mut.Unlock()
+	if ok {
+		return columns, nil
+	}
+
+	rows, err := r.sqlDB.QueryContext(
+		ctx,
+		"SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION",
+		schema, table,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m columnMeta
+		if err := rows.Scan(&m.name, &m.dataType, &m.columnType); err != nil {
+			return nil, err
+		}
+		m.dataType = strings.ToLower(m.dataType)
+		columns = append(columns, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mut.Lock()
+	r.cache[key] = columns
+	r.mut.Unlock()
+	return columns, nil
+}
+
+// invalidate 表结构变更后清除缓存.
+func (r *metaResolver) invalidate() {
+	r.mut.Lock()
+	r.cache = make(map[string][]columnMeta)
+	r.mut.Unlock()
+}
+
+func hasEnumOrSet(t *tableMap) bool {
+	for _, c := range t.columns {
+		if c.typ == typeEnum || c.typ == typeSet {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnumValues 解析 enum('a','b') 或 set('a','b') 的取值.
+func parseEnumValues(columnType string) []string {
+	start := strings.IndexByte(columnType, '(')
+	if start < 0 {
+		return nil
+	}
+	var (
+		values []string
+		sb     strings.Builder
+		quoted bool
+	)
+	s := columnType[start+1:]
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case !quoted && ch == '\'':
+			quoted = true
+		case quoted && ch == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			sb.WriteByte('\'')
+			i++
+		case quoted && ch == '\'':
+			quoted = false
+			values = append(values, sb.String())
+			sb.Reset()
+		case quoted:
+			sb.WriteByte(ch)
+		}
+	}
+	return values
+}
@@ -0,0 +1,175 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tp-life/driver/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sink 事件投递目标.
+//
+// 每次投递一个事务内监听表的全部事件. 投递至少一次, 重连后可能重复投递, 需保证幂等.
+type Sink interface {
+	Handle(ctx context.Context, events []*Event) error
+}
+
+// SinkFunc 函数形式的 Sink.
+type SinkFunc func(ctx context.Context, events []*Event) error
+
+func (f SinkFunc) Handle(ctx context.Context, events []*Event) error {
+	return f(ctx, events)
+}
+
+// NewCacheSink 创建按主键失效 db.QueryCache 的 Sink, 替代写入时的双写失效.
+//
+// idColumn 为主键列名, 更新主键时新旧主键均失效.
+// binlog 解码的主键值与 GetCached 的主键按 QueryCache 相同规则生成 key, 如 []byte 与 string 等价.
+func NewCacheSink(c *db.QueryCache, idColumn string) Sink {
+	return SinkFunc(func(ctx context.Context, events []*Event) error {
+		ids := make(map[string][]interface{})
+		var tables []string
+		for _, e := range events {
+			if _, ok := ids[e.Table]; !ok {
+				tables = append(tables, e.Table)
+			}
+			for _, row := range []map[string]interface{}{e.Before, e.After} {
+				if id, ok := row[idColumn]; ok && id != nil {
+					ids[e.Table] = append(ids[e.Table], id)
+				}
+			}
+		}
+		for _, table := range tables {
+			c.Invalidate(ctx, table, ids[table]...)
+		}
+		return nil
+	})
+}
+
+// Checkpointer 保存已投递的位点, 重启后从检查点继续.
+type Checkpointer interface {
+	// Load 返回保存的位点, 未保存时返回 nil.
+	Load(ctx context.Context) (*Position, error)
+	Save(ctx context.Context, pos Position) error
+}
+
+type memoryCheckpoint struct {
+	mut sync.Mutex
+	pos *Position
+}
+
+// NewMemoryCheckpoint 创建内存检查点, 重启后从当前位点开始.
+func NewMemoryCheckpoint() Checkpointer {
+	return &memoryCheckpoint{}
+}
+
+func (c *memoryCheckpoint) Load(ctx context.Context) (*Position, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.pos == nil {
+		return nil, nil
+	}
+	pos := *c.pos
+	return &pos, nil
+}
+
+func (c *memoryCheckpoint) Save(ctx context.Context, pos Position) error {
+	c.mut.Lock()
+	c.pos = &pos
+	c.mut.Unlock()
+	return nil
+}
+
+type fileCheckpoint struct {
+	path string
+}
+
+// NewFileCheckpoint 创建本地文件检查点, 以 JSON 保存.
+func NewFileCheckpoint(path string) Checkpointer {
+	return &fileCheckpoint{path: path}
+}
+
+func (c *fileCheckpoint) Load(ctx context.Context) (*Position, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pos Position
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return nil, err
+	}
+	return &pos, nil
+}
+
+// Save 先写临时文件再重命名, 避免写入中断损坏检查点.
+func (c *fileCheckpoint) Save(ctx context.Context, pos Position) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// CheckpointRecord 数据库检查点记录.
+type CheckpointRecord struct {
+	Name      string `gorm:"primaryKey;size:64"`
+	File      string `gorm:"size:255"`
+	Pos       uint32
+	UpdatedAt time.Time
+}
+
+func (CheckpointRecord) TableName() string {
+	return "cdc_checkpoints"
+}
+
+type dbCheckpoint struct {
+	provider db.Provider
+	name     string
+}
+
+// NewDBCheckpoint 创建数据库检查点, 保存在 cdc_checkpoints 表, name 区分不同监听.
+//
+// 可通过 AutoMigrate(&CheckpointRecord{}) 或迁移脚本创建表.
+func NewDBCheckpoint(p db.Provider, name string) Checkpointer {
+	return &dbCheckpoint{provider: p, name: name}
+}
+
+func (c *dbCheckpoint) Load(ctx context.Context) (*Position, error) {
+	var record CheckpointRecord
+	err := c.provider.UseWriteDB(ctx).Where("name = ?", c.name).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Position{File: record.File, Pos: record.Pos}, nil
+}
+
+func (c *dbCheckpoint) Save(ctx context.Context, pos Position) error {
+	record := &CheckpointRecord{Name: c.name, File: pos.File, Pos: pos.Pos}
+	return c.provider.UseWriteDB(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(record).Error
+}
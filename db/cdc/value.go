@@ -0,0 +1,366 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 列类型.
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDateTime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDateTime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// absent 最小行镜像(binlog_row_image=MINIMAL)中未记录的列.
+type absent struct{}
+
+// decoder 解码行镜像.
+type decoder struct {
+	loc *time.Location
+}
+
+// row 解码一行, 返回各列值与占用字节数.
+func (d *decoder) row(t *tableMap, present []byte, data []byte) ([]interface{}, int, error) {
+	n := 0
+	for _, b := range present {
+		n += bits.OnesCount8(b)
+	}
+	nulls := data[:(n+7)/8]
+	pos := len(nulls)
+	values := make([]interface{}, len(t.columns))
+	idx := 0
+	for i, c := range t.columns {
+		if present[i/8]&(1<<(i%8)) == 0 {
+			values[i] = absent{}
+			continue
+		}
+		isNull := nulls[idx/8]&(1<<(idx%8)) != 0
+		idx++
+		if isNull {
+			continue
+		}
+		v, size, err := d.value(c, data[pos:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("cdc: %s.%s column %s: %w", t.schema, t.table, c.name, err)
+		}
+		values[i] = v
+		pos += size
+	}
+	return values, pos, nil
+}
+
+// value 解码单列值, 返回值与占用字节数.
+func (d *decoder) value(c *column, data []byte) (interface{}, int, error) {
+	switch c.typ {
+	case typeTiny:
+		if c.unsigned {
+			return uint64(data[0]), 1, nil
+		}
+		return int64(int8(data[0])), 1, nil
+	case typeShort:
+		v := binary.LittleEndian.Uint16(data)
+		if c.unsigned {
+			return uint64(v), 2, nil
+		}
+		return int64(int16(v)), 2, nil
+	case typeInt24:
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		if c.unsigned {
+			return uint64(v), 3, nil
+		}
+		if v&0x800000 != 0 {
+			v |= 0xff000000
+		}
+		return int64(int32(v)), 3, nil
+	case typeLong:
+		v := binary.LittleEndian.Uint32(data)
+		if c.unsigned {
+			return uint64(v), 4, nil
+		}
+		return int64(int32(v)), 4, nil
+	case typeLongLong:
+		v := binary.LittleEndian.Uint64(data)
+		if c.unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+	case typeFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), 4, nil
+	case typeDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case typeYear:
+		if data[0] == 0 {
+			return 0, 1, nil
+		}
+		return int(data[0]) + 1900, 1, nil
+	case typeNewDecimal:
+		return decodeDecimal(data, int(c.meta>>8), int(c.meta&0xff))
+	case typeBit:
+		size := (int(c.meta>>8)*8 + int(c.meta&0xff) + 7) / 8
+		return readBigEndian(data[:size]), size, nil
+	case typeDate:
+		v := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+		return d.date(int(v>>9), int(v>>5&15), int(v&31), 0, 0, 0, 0), 3, nil
+	case typeDateTime:
+		v := binary.LittleEndian.Uint64(data)
+		date, clock := int(v/1000000), int(v%1000000)
+		return d.date(date/10000, date/100%100, date%100, clock/10000, clock/100%100, clock%100, 0), 8, nil
+	case typeDateTime2:
+		return d.dateTime2(data, int(c.meta))
+	case typeTimestamp:
+		return d.unix(int64(binary.LittleEndian.Uint32(data)), 0), 4, nil
+	case typeTimestamp2:
+		frac, n := readFrac(data[4:], int(c.meta))
+		return d.unix(int64(binary.BigEndian.Uint32(data)), frac), 4 + n, nil
+	case typeTime:
+		v := int32(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16)
+		if v&0x800000 != 0 {
+			v |= -1 << 24
+		}
+		sign := time.Duration(1)
+		if v < 0 {
+			sign, v = -1, -v
+		}
+		return sign * (time.Duration(v/10000)*time.Hour + time.Duration(v/100%100)*time.Minute + time.Duration(v%100)*time.Second), 3, nil
+	case typeTime2:
+		return decodeTime2(data, int(c.meta))
+	case typeEnum:
+		size := int(c.meta & 0xff)
+		idx := int(readLittleEndian(data[:size]))
+		if idx > 0 && idx <= len(c.values) {
+			return c.values[idx-1], size, nil
+		}
+		return strconv.Itoa(idx), size, nil
+	case typeSet:
+		size := int(c.meta & 0xff)
+		mask := readLittleEndian(data[:size])
+		if len(c.values) == 0 {
+			return strconv.FormatUint(mask, 10), size, nil
+		}
+		var items []string
+		for i, v := range c.values {
+			if mask&(1<<i) != 0 {
+				items = append(items, v)
+			}
+		}
+		return strings.Join(items, ","), size, nil
+	case typeVarchar, typeVarString, typeString:
+		prefix := 1
+		if c.meta >= 256 {
+			prefix = 2
+		}
+		n := int(readLittleEndian(data[:prefix]))
+		return d.text(c, data[prefix:prefix+n]), prefix + n, nil
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry:
+		prefix := int(c.meta)
+		n := int(readLittleEndian(data[:prefix]))
+		raw := data[prefix : prefix+n]
+		if c.typ == typeGeometry {
+			return append([]byte{}, raw...), prefix + n, nil
+		}
+		return d.text(c, raw), prefix + n, nil
+	case typeJSON:
+		prefix := int(c.meta)
+		n := int(readLittleEndian(data[:prefix]))
+		if n == 0 {
+			return nil, prefix, nil
+		}
+		v, err := decodeJSON(data[prefix : prefix+n])
+		if err != nil {
+			return nil, 0, err
+		}
+		raw, err := json.Marshal(v)
+		return json.RawMessage(raw), prefix + n, err
+	default:
+		return nil, 0, fmt.Errorf("unsupported column type %d", c.typ)
+	}
+}
+
+// text 二进制列返回 []byte, 其他返回字符串.
+func (d *decoder) text(c *column, raw []byte) interface{} {
+	if c.binary {
+		return append([]byte{}, raw...)
+	}
+	return string(raw)
+}
+
+// date 构造时间, 零日期返回零值 time.Time.
+func (d *decoder) date(year, month, day, hour, minute, second, micro int) time.Time {
+	if year == 0 && month == 0 && day == 0 {
+		return time.Time{}
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, micro*1000, d.loc)
+}
+
+// unix 构造 TIMESTAMP, 零值 0000-00-00 00:00:00 返回零值 time.Time.
+func (d *decoder) unix(sec, micro int64) time.Time {
+	if sec == 0 && micro == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, micro*1000).In(d.loc)
+}
+
+func (d *decoder) dateTime2(data []byte, fsp int) (interface{}, int, error) {
+	// 1 位符号, 17 位年*13+月, 5 位日, 5 位时, 6 位分, 6 位秒
+	v := int64(readBigEndian(data[:5])) - 0x8000000000
+	frac, n := readFrac(data[5:], fsp)
+	ymd, hms := v>>17, v&(1<<17-1)
+	ym := ymd >> 5
+	return d.date(int(ym/13), int(ym%13), int(ymd&31), int(hms>>12), int(hms>>6&63), int(hms&63), int(frac)), 5 + n, nil
+}
+
+// readFrac 读取 DATETIME2/TIMESTAMP2/TIME2 的小数秒, 返回微秒与占用字节数.
+func readFrac(data []byte, fsp int) (int64, int) {
+	switch fsp {
+	case 1, 2:
+		return int64(data[0]) * 10000, 1
+	case 3, 4:
+		return int64(binary.BigEndian.Uint16(data)) * 100, 2
+	case 5, 6:
+		return int64(readBigEndian(data[:3])), 3
+	}
+	return 0, 0
+}
+
+func decodeTime2(data []byte, fsp int) (interface{}, int, error) {
+	const intOffset, offset = 0x800000, 0x800000000000
+	var packed int64
+	size := 3
+	switch fsp {
+	case 1, 2:
+		intPart, frac := int64(readBigEndian(data[:3]))-intOffset, int64(data[3])
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x100
+		}
+		packed, size = intPart<<24+frac*10000, 4
+	case 3, 4:
+		intPart, frac := int64(readBigEndian(data[:3]))-intOffset, int64(binary.BigEndian.Uint16(data[3:]))
+		if intPart < 0 && frac != 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		packed, size = intPart<<24+frac*100, 5
+	case 5, 6:
+		packed, size = int64(readBigEndian(data[:6]))-offset, 6
+	default:
+		packed = (int64(readBigEndian(data[:3])) - intOffset) << 24
+	}
+	return packedTime(packed), size, nil
+}
+
+// packedTime 转换 MySQL 打包格式的 TIME.
+func packedTime(packed int64) time.Duration {
+	sign := time.Duration(1)
+	if packed < 0 {
+		sign, packed = -1, -packed
+	}
+	hms, micro := packed>>24, packed&(1<<24-1)
+	d := time.Duration(hms>>12&(1<<10-1))*time.Hour +
+		time.Duration(hms>>6&63)*time.Minute +
+		time.Duration(hms&63)*time.Second +
+		time.Duration(micro)*time.Microsecond
+	return sign * d
+}
+
+var decimalCompressedBytes = [10]int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+// decodeDecimal 解码 DECIMAL 二进制格式为字符串, 避免精度损失.
+func decodeDecimal(data []byte, precision, scale int) (interface{}, int, error) {
+	const digitsPerInt = 9
+	integral := precision - scale
+	uncompIntegral, uncompFractional := integral/digitsPerInt, scale/digitsPerInt
+	compIntegral, compFractional := integral%digitsPerInt, scale%digitsPerInt
+	size := uncompIntegral*4 + decimalCompressedBytes[compIntegral] + uncompFractional*4 + decimalCompressedBytes[compFractional]
+
+	buf := append([]byte{}, data[:size]...)
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] ^= 0xff
+		}
+	}
+
+	var sb strings.Builder
+	if negative {
+		sb.WriteByte('-')
+	}
+	pos := 0
+	var intPart strings.Builder
+	if n := decimalCompressedBytes[compIntegral]; n > 0 {
+		intPart.WriteString(strconv.FormatUint(readBigEndian(buf[pos:pos+n]), 10))
+		pos += n
+	}
+	for i := 0; i < uncompIntegral; i++ {
+		fmt.Fprintf(&intPart, "%09d", binary.BigEndian.Uint32(buf[pos:]))
+		pos += 4
+	}
+	digits := strings.TrimLeft(intPart.String(), "0")
+	if digits == "" {
+		digits = "0"
+	}
+	sb.WriteString(digits)
+	if scale > 0 {
+		sb.WriteByte('.')
+		for i := 0; i < uncompFractional; i++ {
+			fmt.Fprintf(&sb, "%09d", binary.BigEndian.Uint32(buf[pos:]))
+			pos += 4
+		}
+		if n := decimalCompressedBytes[compFractional]; n > 0 {
+			fmt.Fprintf(&sb, "%0*d", compFractional, readBigEndian(buf[pos:pos+n]))
+		}
+	}
+	return sb.String(), size, nil
+}
+
+func readBigEndian(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func readLittleEndian(data []byte) uint64 {
+	var v uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(data[i])
+	}
+	return v
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	sqlCommentPluginName = "driver:sql_comment"
+	sqlCommentPoolKey    = "driver:sql_comment_pool"
+)
+
+// 常用注释键.
+const (
+	SQLCommentService   = "service"
+	SQLCommentRoute     = "route"
+	SQLCommentRequestID = "request_id"
+	SQLCommentTraceID   = "trace_id"
+	SQLCommentTenant    = "tenant"
+)
+
+// SQLCommentOptions 定义 SQL 注释内容.
+//
+// 每条语句前添加 /*key='value',...*/ 注释, 便于在 processlist 与慢日志中定位调用方.
+// 键值经 URL 编码, 输入中的 */ 和引号无法提前结束注释.
+type SQLCommentOptions struct {
+	// 服务名, 固定写入 service 键.
+	Service string
+	// 按键从 context 提取注释值, 空值不写入.
+	Extractors map[string]func(context.Context) string
+}
+
+type sqlCommentCtxKey struct{}
+
+// ContextWithSQLComment 在 context 中附加 SQL 注释键值, 如路由、gRPC 方法.
+//
+// 同名键以最近一次为准, Extractors 提取的同名键优先.
+func ContextWithSQLComment(ctx context.Context, key, value string) context.Context {
+	parent, _ := ctx.Value(sqlCommentCtxKey{}).(map[string]string)
+	values := make(map[string]string, len(parent)+1)
+	for k, v := range parent {
+		values[k] = v
+	}
+	values[key] = value
+	return context.WithValue(ctx, sqlCommentCtxKey{}, values)
+}
+
+// sqlCommentPlugin 实现 SQL 注释注入的 gorm 插件.
+//
+// 由 RuntimeOptions.SQLComment 开启.
+type sqlCommentPlugin struct {
+	opts SQLCommentOptions
+}
+
+func newSQLCommentPlugin(opts *SQLCommentOptions) *sqlCommentPlugin {
+	return &sqlCommentPlugin{opts: *opts}
+}
+
+func (p *sqlCommentPlugin) Name() string {
+	return sqlCommentPluginName
+}
+
+// Initialize 在执行回调前后替换 ConnPool, 此时读写分离已完成选库, 事务已开启.
+func (p *sqlCommentPlugin) Initialize(db *gorm.DB) error {
+	before, after := sqlCommentPluginName+":before", sqlCommentPluginName+":after"
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(before, p.wrap),
+		cb.Create().After("gorm:create").Register(after, p.unwrap),
+		cb.Query().Before("gorm:query").Register(before, p.wrap),
+		cb.Query().After("gorm:query").Register(after, p.unwrap),
+		cb.Update().Before("gorm:update").Register(before, p.wrap),
+		cb.Update().After("gorm:update").Register(after, p.unwrap),
+		cb.Delete().Before("gorm:delete").Register(before, p.wrap),
+		cb.Delete().After("gorm:delete").Register(after, p.unwrap),
+		cb.Row().Before("gorm:row").Register(before, p.wrap),
+		cb.Row().After("gorm:row").Register(after, p.unwrap),
+		cb.Raw().Before("gorm:raw").Register(before, p.wrap),
+		cb.Raw().After("gorm:raw").Register(after, p.unwrap),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *sqlCommentPlugin) wrap(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	comment := p.comment(db.Statement.Context)
+	if comment == "" {
+		return
+	}
+	db.InstanceSet(sqlCommentPoolKey, db.Statement.ConnPool)
+	db.Statement.ConnPool = &commentConnPool{ConnPool: db.Statement.ConnPool, comment: comment}
+}
+
+func (p *sqlCommentPlugin) unwrap(db *gorm.DB) {
+	if pool, ok := db.InstanceGet(sqlCommentPoolKey); ok {
+		db.Statement.ConnPool = pool.(gorm.ConnPool)
+	}
+}
+
+// comment 生成 /*key='value',...*/ 注释, 键按字典序排列.
+func (p *sqlCommentPlugin) comment(ctx context.Context) string {
+	values := make(map[string]string)
+	if ctxValues, ok := ctx.Value(sqlCommentCtxKey{}).(map[string]string); ok {
+		for k, v := range ctxValues {
+			values[k] = v
+		}
+	}
+	if p.opts.Service != "" {
+		values[SQLCommentService] = p.opts.Service
+	}
+	for key, extract := range p.opts.Extractors {
+		if v := extract(ctx); v != "" {
+			values[key] = v
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = escapeSQLComment(k) + "='" + escapeSQLComment(values[k]) + "'"
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/ "
+}
+
+// escapeSQLComment URL 编码, 编码后不含 * / ' 等字符.
+func escapeSQLComment(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// commentConnPool 为执行的 SQL 添加注释前缀.
+type commentConnPool struct {
+	gorm.ConnPool
+	comment string
+}
+
+func (c *commentConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return c.ConnPool.PrepareContext(ctx, c.comment+query)
+}
+
+func (c *commentConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.ConnPool.ExecContext(ctx, c.comment+query, args...)
+}
+
+func (c *commentConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.ConnPool.QueryContext(ctx, c.comment+query, args...)
+}
+
+func (c *commentConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.ConnPool.QueryRowContext(ctx, c.comment+query, args...)
+}
@@ -2,8 +2,12 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"math/rand"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/tp-life/driver/db/transaction"
 
@@ -34,7 +38,8 @@ type SourceBuilder interface {
 }
 
 // NewProvider 创建支持事务管理的 db.Provider
-// Scopes 在新会话创建后通过 db.Scopes(Scopes...) 应用.
+// Scopes 在新会话创建后通过 db.Scopes(Scopes...) 应用, 未命名的 Scopes 依次命名为 scope0、scope1...
+// 可通过 WithoutScopes、WithScopes 按 context 控制.
 // 数据源、Provider、事务管理、插件集成参照:
 // Notice: 不同 Provider 间的事务不共享.
 func NewProvider(opts SourceBuilder, rOptsList ...*RuntimeOptions) *TransProvider {
@@ -55,18 +60,42 @@ func NewProvider(opts SourceBuilder, rOptsList ...*RuntimeOptions) *TransProvide
 		panic(err)
 	}
 
+	scopes := make([]NamedScope, 0, len(rOpts.Scopes)+len(rOpts.NamedScopes))
+	for i, scope := range rOpts.Scopes {
+		scopes = append(scopes, NamedScope{Name: fmt.Sprintf("scope%d", i), Scope: scope})
+	}
+	scopes = append(scopes, rOpts.NamedScopes...)
+	logger := rOpts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	p := &TransProvider{
-		Source:   src,
-		scopes:   rOpts.Scopes,
-		txSuffix: strconv.FormatInt(rand.Int63(), 10),
+		Source:       src,
+		scopes:       scopes,
+		logger:       logger,
+		txSuffix:     strconv.FormatInt(rand.Int63(), 10),
+		retryBackoff: rOpts.Retry.backoff(),
 	}
 	lookupDB := func(ctx context.Context) interface{} {
 		return p.lookupDB(ctx, true)
 	}
 	p.Manager = transaction.NewManager(p.getCtxKey, lookupDB, p.transaction)
+
+	// 依赖 Provider 的插件在创建后绑定.
+	for _, plugin := range rOpts.Plugins {
+		if binder, ok := plugin.(providerBinder); ok {
+			binder.bindProvider(p)
+		}
+	}
 	return p
 }
 
+// providerBinder 需要访问 Provider 的插件.
+type providerBinder interface {
+	bindProvider(p *TransProvider)
+}
+
 // ToProvider 转换 *TransProvider 为 Provider.
 // 用于依赖注入的工厂函数.
 func ToProvider(tp *TransProvider) Provider {
@@ -85,7 +114,14 @@ type TransProvider struct {
 	transaction.Manager
 
 	txSuffix string
-	scopes   []func(*gorm.DB) *gorm.DB
+	scopes   []NamedScope
+	logger   *slog.Logger
+
+	// RetryTransaction 重试间隔.
+	retryBackoff time.Duration
+
+	// 事务持有的命名锁, 以根事务 DB 为 key.
+	namedLocks sync.Map
 }
 
 //var _ transaction.Manager = new(TransProvider)
@@ -125,9 +161,21 @@ func (p *TransProvider) isInTransaction(ctx context.Context) bool {
 // transaction 执行数据库事务.
 func (p *TransProvider) transaction(ctx context.Context, db interface{}, callback func(db interface{}) error) error {
 	if p.isInTransaction(ctx) {
+		if t := findDetachedTx(ctx); t != nil {
+			return t.savepoint(ctx, db.(*gorm.DB), callback)
+		}
 		return callback(db)
 	}
+	var tx *gorm.DB
+	defer func() {
+		// 独立会话上的命名锁在事务提交或回滚后释放, 避免其他会话在提交前取得锁.
+		if tx != nil {
+			p.releaseSessionNamedLocks(ctx, tx)
+		}
+	}()
 	return db.(*gorm.DB).Transaction(func(db *gorm.DB) error {
+		tx = db
+		defer p.releaseTxNamedLocks(db)
 		return callback(db)
 	})
 }
@@ -143,7 +191,7 @@ func (p *TransProvider) useDB(ctx context.Context, write bool) *gorm.DB {
 	// 默认不支持嵌套事务
 	sess := &gorm.Session{Context: ctx, DisableNestedTransaction: true}
 
-	return db.Session(sess).Scopes(p.scopes...)
+	return db.Session(sess).Scopes(p.applyScopes(ctx)...)
 }
 
 // UseDB 实现通过 context 选择数据库.
@@ -0,0 +1,206 @@
+// Package dbtest 提供单元测试与集成测试使用的 db.Provider、transaction.Manager 实现.
+package dbtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tp-life/driver/db/transaction"
+)
+
+// Tx 记录一次 Transaction 调用.
+type Tx struct {
+	// 按开始顺序从 1 编号.
+	ID int
+	// 嵌套深度, 根事务为 1.
+	Depth  int
+	Parent *Tx
+
+	// 事务结果, 包含回调返回的错误与模拟的提交错误.
+	Err error
+	// 根事务为提交成功, 嵌套事务为保存点释放成功.
+	Committed  bool
+	RolledBack bool
+	Panicked   bool
+
+	Callbacks []*Callback
+}
+
+// Persisted 返回事务及全部上级事务是否提交成功.
+func (tx *Tx) Persisted() bool {
+	for ; tx != nil; tx = tx.Parent {
+		if !tx.Committed {
+			return false
+		}
+	}
+	return true
+}
+
+// Callback 记录一次 OnCommitted 注册.
+type Callback struct {
+	// 注册所在事务.
+	Tx    *Tx
+	Fired bool
+}
+
+// Manager 记录事务调用的 transaction.Manager, 不依赖数据库.
+//
+// Transaction 嵌套时模拟保存点, 根事务结束时按结果触发 OnCommitted 回调.
+type Manager struct {
+	transaction.Manager
+
+	mut       sync.Mutex
+	txs       []*Tx
+	callbacks []*Callback
+	failErr   error
+	panicVal  interface{}
+
+	// 非事务上下文 DB, 由 Provider 设置.
+	db interface{}
+}
+
+var _ transaction.Manager = new(Manager)
+
+type ctxKey struct {
+	m *Manager
+}
+
+// txDB 事务上下文中的 DB, 携带当前事务记录.
+type txDB struct {
+	db interface{}
+	tx *Tx
+}
+
+// NewManager 创建记录事务调用的 transaction.Manager.
+func NewManager() *Manager {
+	m := &Manager{}
+	m.Manager = transaction.NewManager(m.ctxKey, m.lookupDB, m.transaction)
+	return m
+}
+
+func (m *Manager) ctxKey(context.Context) interface{} {
+	return ctxKey{m: m}
+}
+
+func (m *Manager) lookupDB(context.Context) interface{} {
+	return &txDB{db: m.db}
+}
+
+// transaction 记录事务并模拟提交失败与 panic.
+func (m *Manager) transaction(ctx context.Context, db interface{}, callback func(db interface{}) error) (err error) {
+	parent := db.(*txDB).tx
+	tx := &Tx{Parent: parent, Depth: 1}
+	if parent != nil {
+		tx.Depth = parent.Depth + 1
+	}
+	m.mut.Lock()
+	m.txs = append(m.txs, tx)
+	tx.ID = len(m.txs)
+	m.mut.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			m.mut.Lock()
+			tx.Panicked, tx.RolledBack = true, true
+			m.mut.Unlock()
+			panic(r)
+		}
+	}()
+
+	err = callback(&txDB{db: db.(*txDB).db, tx: tx})
+	m.mut.Lock()
+	if err == nil && parent == nil {
+		if m.panicVal != nil {
+			v := m.panicVal
+			m.panicVal = nil
+			m.mut.Unlock()
+			panic(v)
+		}
+		err, m.failErr = m.failErr, nil
+	}
+	tx.Err = err
+	tx.Committed, tx.RolledBack = err == nil, err != nil
+	m.mut.Unlock()
+	return err
+}
+
+// FailNextCommit 使下一次根事务提交返回 err, 事务回滚, OnCommitted 回调不触发.
+func (m *Manager) FailNextCommit(err error) {
+	m.mut.Lock()
+	m.failErr = err
+	m.mut.Unlock()
+}
+
+// PanicNextCommit 使下一次根事务提交时 panic(v).
+func (m *Manager) PanicNextCommit(v interface{}) {
+	m.mut.Lock()
+	m.panicVal = v
+	m.mut.Unlock()
+}
+
+// OnCommitted 注册回调并记录是否触发.
+func (m *Manager) OnCommitted(ctx context.Context, callback func(context.Context)) bool {
+	tx := m.Current(ctx)
+	if tx == nil {
+		return m.Manager.OnCommitted(ctx, callback)
+	}
+	cb := &Callback{Tx: tx}
+	ok := m.Manager.OnCommitted(ctx, func(ctx context.Context) {
+		m.mut.Lock()
+		cb.Fired = true
+		m.mut.Unlock()
+		callback(ctx)
+	})
+	m.mut.Lock()
+	tx.Callbacks = append(tx.Callbacks, cb)
+	m.callbacks = append(m.callbacks, cb)
+	m.mut.Unlock()
+	return ok
+}
+
+// Current 返回 context 所在事务, 不在事务中返回 nil.
+func (m *Manager) Current(ctx context.Context) *Tx {
+	if db := m.transDB(ctx); db != nil {
+		return db.tx
+	}
+	return nil
+}
+
+// Depth 返回 context 所在事务的嵌套深度, 不在事务中返回 0.
+func (m *Manager) Depth(ctx context.Context) int {
+	if tx := m.Current(ctx); tx != nil {
+		return tx.Depth
+	}
+	return 0
+}
+
+func (m *Manager) transDB(ctx context.Context) *txDB {
+	tc, ok := ctx.Value(m.ctxKey(ctx)).(transaction.TransContext)
+	if !ok {
+		return nil
+	}
+	db, _ := tc.GetTransDB().(*txDB)
+	return db
+}
+
+// Transactions 按开始顺序返回全部事务记录.
+func (m *Manager) Transactions() []*Tx {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return append([]*Tx(nil), m.txs...)
+}
+
+// Callbacks 按注册顺序返回全部 OnCommitted 记录.
+func (m *Manager) Callbacks() []*Callback {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return append([]*Callback(nil), m.callbacks...)
+}
+
+// Reset 清除记录与未触发的模拟失败.
+func (m *Manager) Reset() {
+	m.mut.Lock()
+	m.txs, m.callbacks = nil, nil
+	m.failErr, m.panicVal = nil, nil
+	m.mut.Unlock()
+}
@@ -0,0 +1,132 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/tp-life/driver/db"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var ErrNoDatabase = errors.New("dbtest: fake provider has no database")
+
+// Statement 记录一条 SQL.
+type Statement struct {
+	SQL  string
+	Vars []interface{}
+	// 执行所在事务, 不在事务中为 nil.
+	Tx *Tx
+}
+
+// Provider 不依赖数据库的 db.Provider 与 transaction.Manager 实现.
+//
+// UseDB、UseWriteDB 返回 DryRun 模式的 MySQL 会话, 语句只生成不执行, 查询结果为空.
+// 可通过 Statements 断言生成的 SQL 及其所在事务.
+type Provider struct {
+	*Manager
+
+	db *gorm.DB
+
+	mut        sync.Mutex
+	statements []Statement
+}
+
+var _ db.Provider = new(Provider)
+
+// NewProvider 创建不依赖数据库的 Provider.
+func NewProvider() *Provider {
+	gdb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      noConnPool{},
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{Manager: NewManager(), db: gdb}
+	p.Manager.db = gdb
+	record := func(tx *gorm.DB) {
+		if tx.Statement.SQL.Len() == 0 {
+			return
+		}
+		p.mut.Lock()
+		p.statements = append(p.statements, Statement{
+			SQL:  tx.Statement.SQL.String(),
+			Vars: append([]interface{}(nil), tx.Statement.Vars...),
+			Tx:   p.Current(tx.Statement.Context),
+		})
+		p.mut.Unlock()
+	}
+	cb := gdb.Callback()
+	for _, err := range []error{
+		cb.Create().After("gorm:create").Register("dbtest:record", record),
+		cb.Query().After("gorm:query").Register("dbtest:record", record),
+		cb.Update().After("gorm:update").Register("dbtest:record", record),
+		cb.Delete().After("gorm:delete").Register("dbtest:record", record),
+		cb.Row().After("gorm:row").Register("dbtest:record", record),
+		cb.Raw().After("gorm:raw").Register("dbtest:record", record),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+	return p
+}
+
+func (p *Provider) useDB(ctx context.Context) *gorm.DB {
+	return p.db.Session(&gorm.Session{Context: ctx, NewDB: true})
+}
+
+// UseDB 返回 DryRun 会话.
+func (p *Provider) UseDB(ctx context.Context) *gorm.DB {
+	return p.useDB(ctx)
+}
+
+// UseWriteDB 返回 DryRun 会话.
+func (p *Provider) UseWriteDB(ctx context.Context) *gorm.DB {
+	return p.useDB(ctx)
+}
+
+// Statements 按执行顺序返回生成的 SQL.
+func (p *Provider) Statements() []Statement {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return append([]Statement(nil), p.statements...)
+}
+
+// Reset 清除事务、回调与 SQL 记录.
+func (p *Provider) Reset() {
+	p.Manager.Reset()
+	p.mut.Lock()
+	p.statements = nil
+	p.mut.Unlock()
+}
+
+// noConnPool DryRun 模式下不会被调用的连接池.
+type noConnPool struct{}
+
+func (noConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, ErrNoDatabase
+}
+
+func (noConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, ErrNoDatabase
+}
+
+func (noConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, ErrNoDatabase
+}
+
+func (noConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return &sql.Row{}
+}
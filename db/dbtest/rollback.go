@@ -0,0 +1,50 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tp-life/driver/db"
+)
+
+// Harness 单个测试的回滚事务.
+type Harness struct {
+	tx *db.DetachedTx
+}
+
+// Begin 在根事务中执行测试, 测试结束时回滚, 用于共享本地数据库的隔离测试.
+//
+// 被测代码使用返回的 context, 其中嵌套的 Manager.Transaction 以保存点实现,
+// OnCommitted 回调通过 Flush 手动触发.
+//
+// 例:
+//
+//	func TestCreateUser(t *testing.T) {
+//	    ctx, h := dbtest.Begin(t, provider)
+//	    svc.CreateUser(ctx, ...)
+//	    h.Flush()
+//	}
+func Begin(t testing.TB, p *db.TransProvider) (context.Context, *Harness) {
+	t.Helper()
+	ctx, tx, err := p.BeginDetached(context.Background())
+	if err != nil {
+		t.Fatalf("dbtest: begin transaction: %v", err)
+	}
+	h := &Harness{tx: tx}
+	t.Cleanup(func() {
+		if err := h.Rollback(); err != nil {
+			t.Errorf("dbtest: rollback transaction: %v", err)
+		}
+	})
+	return ctx, h
+}
+
+// Flush 触发已注册且所在保存点未回滚的 OnCommitted 回调.
+func (h *Harness) Flush() {
+	h.tx.Flush()
+}
+
+// Rollback 提前回滚根事务, 测试结束时自动调用.
+func (h *Harness) Rollback() error {
+	return h.tx.Rollback()
+}
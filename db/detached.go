@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tp-life/driver/db/transaction"
+
+	"gorm.io/gorm"
+)
+
+type detachedCtxKey struct{}
+
+// DetachedTx 由调用方结束且始终回滚的根事务, 用于测试隔离.
+type DetachedTx struct {
+	p    *TransProvider
+	db   *gorm.DB
+	root *transaction.Detached
+
+	savepoints atomic.Int64
+	once       sync.Once
+	err        error
+}
+
+// BeginDetached 在写库开启始终回滚的根事务.
+//
+// 返回的 context 中嵌套的 Transaction 以保存点实现, 回调返回错误或 panic 时回滚到保存点.
+// OnCommitted 回调不会自动触发, 通过 Flush 手动触发.
+// Notice: EscapeTransaction 内的事务与 DDL、TRUNCATE 等隐式提交语句不受回滚保护.
+func (p *TransProvider) BeginDetached(ctx context.Context) (context.Context, *DetachedTx, error) {
+	if p.isInTransaction(ctx) {
+		return nil, nil, gorm.ErrInvalidTransaction
+	}
+	db := p.lookupDB(ctx, true).WithContext(ctx).Begin()
+	if db.Error != nil {
+		return nil, nil, db.Error
+	}
+	t := &DetachedTx{p: p, db: db}
+	txCtx, root, err := transaction.Detach(context.WithValue(ctx, detachedCtxKey{}, t), p.Manager, db)
+	if err != nil {
+		_ = t.Rollback()
+		return nil, nil, err
+	}
+	t.root = root
+	return txCtx, t, nil
+}
+
+// Flush 触发已注册的 OnCommitted 回调.
+func (t *DetachedTx) Flush() {
+	t.root.Flush()
+}
+
+// Rollback 回滚根事务, 多次调用返回首次结果.
+func (t *DetachedTx) Rollback() error {
+	t.once.Do(func() {
+		t.p.releaseTxNamedLocks(t.db)
+		t.err = t.db.Rollback().Error
+		t.p.releaseSessionNamedLocks(t.db.Statement.Context, t.db)
+	})
+	return t.err
+}
+
+// savepoint 以保存点执行嵌套事务.
+func (t *DetachedTx) savepoint(ctx context.Context, db *gorm.DB, callback func(db interface{}) error) (err error) {
+	name := "sp" + strconv.FormatInt(t.savepoints.Add(1), 10)
+	tx := db.WithContext(AllowRawSQL(ctx))
+	if err := tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.RollbackTo(name)
+		}
+	}()
+	err = callback(db)
+	panicked = false
+	return err
+}
+
+func findDetachedTx(ctx context.Context) *DetachedTx {
+	t, _ := ctx.Value(detachedCtxKey{}).(*DetachedTx)
+	return t
+}
@@ -0,0 +1,261 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrSchemaDrift = errors.New("schema drift detected")
+)
+
+// DriftKind 结构差异类型.
+type DriftKind string
+
+const (
+	DriftMissingTable     DriftKind = "missing_table"
+	DriftMissingColumn    DriftKind = "missing_column"
+	DriftExtraColumn      DriftKind = "extra_column"
+	DriftTypeMismatch     DriftKind = "type_mismatch"
+	DriftNullableMismatch DriftKind = "nullable_mismatch"
+	DriftMissingIndex     DriftKind = "missing_index"
+	DriftIndexMismatch    DriftKind = "index_mismatch"
+)
+
+// Drift 模型与数据库结构的单项差异.
+type Drift struct {
+	Kind   DriftKind `json:"kind"`
+	Table  string    `json:"table"`
+	Column string    `json:"column,omitempty"`
+	Index  string    `json:"index,omitempty"`
+	// 模型期望值.
+	Expected string `json:"expected,omitempty"`
+	// 数据库实际值.
+	Actual string `json:"actual,omitempty"`
+}
+
+func (d Drift) String() string {
+	target := d.Table
+	if d.Column != "" {
+		target += "." + d.Column
+	}
+	if d.Index != "" {
+		target += " index " + d.Index
+	}
+	if d.Expected == "" && d.Actual == "" {
+		return fmt.Sprintf("%s: %s", d.Kind, target)
+	}
+	return fmt.Sprintf("%s: %s expected %q actual %q", d.Kind, target, d.Expected, d.Actual)
+}
+
+// DriftReport 结构差异报告.
+type DriftReport struct {
+	Drifts []Drift `json:"drifts"`
+}
+
+// HasDrift 返回是否存在差异.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Drifts) > 0
+}
+
+// Err 存在差异时返回包装 ErrSchemaDrift 的错误.
+func (r *DriftReport) Err() error {
+	if !r.HasDrift() {
+		return nil
+	}
+	lines := make([]string, len(r.Drifts))
+	for i, d := range r.Drifts {
+		lines[i] = d.String()
+	}
+	return fmt.Errorf("%w:\n%s", ErrSchemaDrift, strings.Join(lines, "\n"))
+}
+
+// DriftOptions 结构差异检查配置.
+type DriftOptions struct {
+	// 报告数据库中存在但模型未声明的列.
+	ReportExtraColumns bool
+	// 忽略索引检查.
+	IgnoreIndexes bool
+}
+
+// DetectSchemaDrift 对比 gorm 模型与 UseWriteDB 可达的数据库结构, 只读不变更.
+//
+// 检查列、类型、可空性与索引.
+func DetectSchemaDrift(ctx context.Context, p Provider, opts DriftOptions, models ...interface{}) (*DriftReport, error) {
+	db := p.UseWriteDB(AllowRawSQL(ctx))
+	if db == nil {
+		return nil, ErrWriteDBNotConfigured
+	}
+	// 不应用全局 scope.
+	db = db.Session(&gorm.Session{NewDB: true})
+
+	report := &DriftReport{}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		drifts, err := detectModelDrift(db, stmt.Schema, model, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.Drifts = append(report.Drifts, drifts...)
+	}
+	return report, nil
+}
+
+// CheckSchemaDrift 用于启动检查, 存在差异时返回错误.
+func CheckSchemaDrift(ctx context.Context, p Provider, models ...interface{}) error {
+	report, err := DetectSchemaDrift(ctx, p, DriftOptions{}, models...)
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+func detectModelDrift(db *gorm.DB, s *schema.Schema, model interface{}, opts DriftOptions) ([]Drift, error) {
+	migrator := db.Migrator()
+	if !migrator.HasTable(model) {
+		return []Drift{{Kind: DriftMissingTable, Table: s.Table}}, nil
+	}
+
+	columnTypes, err := migrator.ColumnTypes(model)
+	if err != nil {
+		return nil, err
+	}
+	actualColumns := make(map[string]gorm.ColumnType, len(columnTypes))
+	for _, ct := range columnTypes {
+		actualColumns[strings.ToLower(ct.Name())] = ct
+	}
+
+	var drifts []Drift
+	declared := make(map[string]bool)
+	for _, dbName := range s.DBNames {
+		field := s.FieldsByDBName[dbName]
+		declared[strings.ToLower(dbName)] = true
+
+		ct, ok := actualColumns[strings.ToLower(dbName)]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DriftMissingColumn, Table: s.Table, Column: dbName})
+			continue
+		}
+		expected := normalizeColumnType(db.Dialector.DataTypeOf(field))
+		actual, ok := ct.ColumnType()
+		if !ok {
+			actual = ct.DatabaseTypeName()
+		}
+		if expected != "" && expected != normalizeColumnType(actual) {
+			drifts = append(drifts, Drift{Kind: DriftTypeMismatch, Table: s.Table, Column: dbName, Expected: expected, Actual: normalizeColumnType(actual)})
+		}
+		if nullable, ok := ct.Nullable(); ok {
+			expectNullable := !field.NotNull && !field.PrimaryKey
+			if nullable != expectNullable {
+				drifts = append(drifts, Drift{
+					Kind: DriftNullableMismatch, Table: s.Table, Column: dbName,
+					Expected: nullableName(expectNullable), Actual: nullableName(nullable),
+				})
+			}
+		}
+	}
+	if opts.ReportExtraColumns {
+		for _, ct := range columnTypes {
+			if !declared[strings.ToLower(ct.Name())] {
+				drifts = append(drifts, Drift{Kind: DriftExtraColumn, Table: s.Table, Column: ct.Name()})
+			}
+		}
+	}
+
+	if !opts.IgnoreIndexes {
+		indexDrifts, err := detectIndexDrift(db, s, model)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, indexDrifts...)
+	}
+	return drifts, nil
+}
+
+func detectIndexDrift(db *gorm.DB, s *schema.Schema, model interface{}) ([]Drift, error) {
+	actualIndexes, err := db.Migrator().GetIndexes(model)
+	if err != nil {
+		return nil, err
+	}
+	actualByName := make(map[string]gorm.Index, len(actualIndexes))
+	for _, idx := range actualIndexes {
+		actualByName[idx.Name()] = idx
+	}
+
+	expectedIndexes := s.ParseIndexes()
+	names := make([]string, 0, len(expectedIndexes))
+	for name := range expectedIndexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var drifts []Drift
+	for _, name := range names {
+		idx := expectedIndexes[name]
+		expectedColumns := make([]string, len(idx.Fields))
+		for i, opt := range idx.Fields {
+			expectedColumns[i] = opt.DBName
+		}
+		expected := indexSignature(expectedColumns, idx.Class == "UNIQUE")
+
+		actualIdx, ok := actualByName[name]
+		if !ok {
+			drifts = append(drifts, Drift{Kind: DriftMissingIndex, Table: s.Table, Index: name, Expected: expected})
+			continue
+		}
+		unique, _ := actualIdx.Unique()
+		if actual := indexSignature(actualIdx.Columns(), unique); actual != expected {
+			drifts = append(drifts, Drift{Kind: DriftIndexMismatch, Table: s.Table, Index: name, Expected: expected, Actual: actual})
+		}
+	}
+	return drifts, nil
+}
+
+func indexSignature(columns []string, unique bool) string {
+	sig := "(" + strings.ToLower(strings.Join(columns, ",")) + ")"
+	if unique {
+		return "unique " + sig
+	}
+	return sig
+}
+
+func nullableName(nullable bool) string {
+	if nullable {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
+
+var (
+	intDisplayWidthRegexp = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+	columnModifiers       = []string{" auto_increment", " not null", " null", " default ", " comment ", " primary key"}
+)
+
+// normalizeColumnType 归一化列类型, 忽略整数显示宽度、修饰符与空白差异.
+func normalizeColumnType(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	for _, modifier := range columnModifiers {
+		if i := strings.Index(typ, modifier); i >= 0 {
+			typ = typ[:i]
+		}
+	}
+	typ = strings.ReplaceAll(typ, ", ", ",")
+	typ = intDisplayWidthRegexp.ReplaceAllString(typ, "$1")
+	switch {
+	case typ == "boolean" || typ == "bool":
+		typ = "tinyint"
+	case strings.HasPrefix(typ, "integer"):
+		typ = "int" + strings.TrimPrefix(typ, "integer")
+	}
+	return typ
+}
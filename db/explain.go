@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	explainPluginName = "driver:explain"
+	explainStartKey   = "driver:explain_start"
+	// 同一指纹重复采集执行计划的最小间隔.
+	explainDedupInterval = time.Minute
+	explainTimeout       = time.Second
+)
+
+type explainCtxKey struct{}
+
+// explainHolder 在 context 中传递执行计划给 LoggerWrapper.
+type explainHolder struct {
+	plan string
+}
+
+// explainPlanFrom 返回 context 中当前语句的执行计划.
+func explainPlanFrom(ctx context.Context) string {
+	if h, ok := ctx.Value(explainCtxKey{}).(*explainHolder); ok {
+		return h.plan
+	}
+	return ""
+}
+
+// explainPlugin 对慢 SELECT 在同一连接(读库、写库或事务)上执行 EXPLAIN.
+//
+// 由 Options.ExplainSlow 开启, 计划随慢查询日志输出.
+type explainPlugin struct {
+	threshold time.Duration
+	rate      int
+
+	mut        sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	seen       map[string]time.Time
+}
+
+func newExplainPlugin(threshold time.Duration, rate int) *explainPlugin {
+	if rate <= 0 {
+		rate = 1
+	}
+	return &explainPlugin{threshold: threshold, rate: rate, tokens: float64(rate), lastRefill: time.Now(), seen: make(map[string]time.Time)}
+}
+
+func (p *explainPlugin) Name() string {
+	return explainPluginName
+}
+
+func (p *explainPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register(explainPluginName+":before", p.before); err != nil {
+		return err
+	}
+	// Row/Rows 回调结束时结果集未关闭, 事务连接上无法再执行 EXPLAIN, 只处理 Query.
+	return db.Callback().Query().After("gorm:query").Register(explainPluginName+":after", p.after)
+}
+
+func (p *explainPlugin) before(db *gorm.DB) {
+	stmt := db.Statement
+	if h, ok := stmt.Context.Value(explainCtxKey{}).(*explainHolder); ok {
+		h.plan = ""
+	} else {
+		stmt.Context = context.WithValue(stmt.Context, explainCtxKey{}, &explainHolder{})
+	}
+	db.InstanceSet(explainStartKey, time.Now())
+}
+
+func (p *explainPlugin) after(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || p.threshold <= 0 || stmt.SQL.Len() == 0 {
+		return
+	}
+	v, ok := db.InstanceGet(explainStartKey)
+	if !ok || time.Since(v.(time.Time)) <= p.threshold {
+		return
+	}
+	h, ok := stmt.Context.Value(explainCtxKey{}).(*explainHolder)
+	if !ok {
+		return
+	}
+	sql := stmt.SQL.String()
+	if !isSelectSQL(sql) || !p.allow(Fingerprint(sql)) {
+		return
+	}
+	h.plan = p.explain(db, sql, stmt.Vars)
+}
+
+// allow 限制采集频率, 每秒最多 rate 次, 同一指纹在 explainDedupInterval 内只采集一次.
+func (p *explainPlugin) allow(fingerprint string) bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	now := time.Now()
+	if last, ok := p.seen[fingerprint]; ok && now.Sub(last) < explainDedupInterval {
+		return false
+	}
+
+	p.tokens += now.Sub(p.lastRefill).Seconds() * float64(p.rate)
+	if p.tokens > float64(p.rate) {
+		p.tokens = float64(p.rate)
+	}
+	p.lastRefill = now
+	if p.tokens < 1 {
+		return false
+	}
+	p.tokens--
+
+	if len(p.seen) >= 1000 {
+		p.seen = make(map[string]time.Time)
+	}
+	p.seen[fingerprint] = now
+	return true
+}
+
+// explain 直接使用语句的 ConnPool 执行, 不经过 gorm 回调.
+func (p *explainPlugin) explain(db *gorm.DB, sql string, vars []interface{}) string {
+	prefix := "EXPLAIN "
+	if db.Dialector.Name() == "mysql" {
+		prefix = "EXPLAIN FORMAT=JSON "
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(db.Statement.Context), explainTimeout)
+	defer cancel()
+
+	rows, err := db.Statement.ConnPool.QueryContext(ctx, prefix+sql, vars...)
+	if err != nil {
+		return "explain error: " + err.Error()
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "explain error: " + err.Error()
+	}
+
+	var lines []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return "explain error: " + err.Error()
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				cells[i] = string(b)
+			} else if v != nil {
+				cells[i] = fmt.Sprint(v)
+			}
+		}
+		lines = append(lines, strings.Join(cells, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isSelectSQL(sql string) bool {
+	sql = strings.TrimLeft(sql, " \t\n(")
+	if len(sql) < 6 {
+		return false
+	}
+	head := strings.ToLower(sql[:6])
+	return head == "select" || strings.HasPrefix(head, "with ")
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// fakeConnector 记录执行语句的 database/sql 驱动, 用于不连接 MySQL 的单元测试.
+type fakeConnector struct {
+	mu    sync.Mutex
+	execs []fakeExec
+	// 每条写语句返回的影响行数与自增 ID.
+	affected     int64
+	lastInsertID int64
+}
+
+// fakeExec 执行的语句及参数.
+type fakeExec struct {
+	sql  string
+	args []interface{}
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c: c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return fakeDriver{c: c} }
+
+func (c *fakeConnector) record(query string, args []driver.NamedValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	c.execs = append(c.execs, fakeExec{sql: query, args: values})
+}
+
+// statements 返回已执行的语句并清空记录.
+func (c *fakeConnector) statements() []fakeExec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	execs := c.execs
+	c.execs = nil
+	return execs
+}
+
+type fakeDriver struct{ c *fakeConnector }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{c: d.c}, nil }
+
+type fakeConn struct{ c *fakeConnector }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *fakeConn) Commit() error                       { return nil }
+func (c *fakeConn) Rollback() error                     { return nil }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.c.record(query, args)
+	return fakeResult{affected: c.c.affected, lastInsertID: c.c.lastInsertID}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.c.record(query, args)
+	return fakeRows{}, nil
+}
+
+type fakeResult struct {
+	affected     int64
+	lastInsertID int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// fakeRows 空结果集.
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return nil }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// newFakeDB 创建使用 fakeConnector 的 MySQL 方言 DB 并注册插件.
+func newFakeDB(t *testing.T, plugins ...gorm.Plugin) (*gorm.DB, *fakeConnector) {
+	t.Helper()
+	c := &fakeConnector{affected: 1}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(c), SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plugin := range plugins {
+		if err := db.Use(plugin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, c
+}
+
+// lastExec 返回最后一条语句并清空记录.
+func lastExec(t *testing.T, c *fakeConnector) fakeExec {
+	t.Helper()
+	execs := c.statements()
+	if len(execs) == 0 {
+		t.Fatal("no statement executed")
+	}
+	return execs[len(execs)-1]
+}
+
+// normalizeSQL 去除标识符引号, 便于比较.
+func normalizeSQL(query string) string {
+	return strings.ReplaceAll(query, "`", "")
+}
@@ -0,0 +1,508 @@
+// Package fixtures 从 YAML/JSON 文件加载测试种子数据.
+//
+// 文件按表组织, 每张表为行列表, 或以标签为键的行映射, 列表形式通过 _label 指定标签:
+//
+//	users:
+//	  alice:
+//	    name: alice
+//	    created_at: '{{ now }}'
+//	orders:
+//	  - _label: first
+//	    no: 'NO-{{ seq "order" }}'
+//	    user_id: '{{ ref "users.alice.id" }}'
+//
+// 字符串值按 text/template 求值, 支持以下函数:
+//
+//	now             当前时间
+//	ago "24h"       当前时间之前
+//	later "1h"      当前时间之后
+//	seq "name"      按名称从 1 递增的序号, 每次 Insert 重新开始
+//	ref "t.label.c" 已插入行的列值, 省略列名时为 IDColumn
+//
+// 表按 ref 依赖顺序插入, 同一表内按文件顺序插入.
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/tp-life/driver/db"
+	"github.com/tp-life/driver/db/transaction"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("fixtures: unsupported file format")
+	ErrCircularReference = errors.New("fixtures: circular references between tables")
+)
+
+// labelKey 列表形式中指定行标签的键.
+const labelKey = "_label"
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Provider 加载使用的 DB 与事务管理, 如 *db.TransProvider.
+type Provider interface {
+	db.Provider
+	transaction.Manager
+}
+
+// Options 加载配置.
+type Options struct {
+	// 自增主键列名, 默认 id. 行未指定时插入后读取生成值, 供 ref 引用.
+	IDColumn string
+	// 模板中的当前时间, 默认 time.Now.
+	Now func() time.Time
+	// Truncate 使用 DELETE 清空表, 不重置自增值. context 在事务(如 dbtest.Begin)内时总是使用 DELETE.
+	UseDelete bool
+}
+
+// Fixtures 种子数据.
+type Fixtures struct {
+	p    Provider
+	opts Options
+
+	mut    sync.Mutex
+	tables []*table
+	index  map[string]*table
+	// 已插入的行, 以 表.标签 为 key.
+	rows map[string]map[string]interface{}
+}
+
+type table struct {
+	name string
+	rows []*row
+}
+
+type row struct {
+	label  string
+	values map[string]interface{}
+}
+
+// New 创建种子数据.
+func New(p Provider, opts Options) *Fixtures {
+	if opts.IDColumn == "" {
+		opts.IDColumn = "id"
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Fixtures{
+		p:     p,
+		opts:  opts,
+		index: make(map[string]*table),
+		rows:  make(map[string]map[string]interface{}),
+	}
+}
+
+// AddFiles 读取 .yml、.yaml、.json 文件.
+func (f *Fixtures) AddFiles(paths ...string) error {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := f.Add(path, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add 解析文件内容, name 的扩展名决定格式, 用于 embed 等非本地文件.
+func (f *Fixtures) Add(name string, data []byte) error {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml", ".json":
+		// JSON 按 YAML 解析, 保留表与行的顺序
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("fixtures: %s: %w", name, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("fixtures: %s: top level must be a mapping of tables", name)
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	for i := 0; i < len(root.Content); i += 2 {
+		rows, err := parseRows(root.Content[i+1])
+		if err != nil {
+			return fmt.Errorf("fixtures: %s: table %s: %w", name, root.Content[i].Value, err)
+		}
+		t := f.table(root.Content[i].Value)
+		t.rows = append(t.rows, rows...)
+	}
+	return nil
+}
+
+func (f *Fixtures) table(name string) *table {
+	t, ok := f.index[name]
+	if !ok {
+		t = &table{name: name}
+		f.index[name] = t
+		f.tables = append(f.tables, t)
+	}
+	return t
+}
+
+// parseRows 解析行列表或以标签为键的行映射.
+func parseRows(node *yaml.Node) ([]*row, error) {
+	var rows []*row
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			r := &row{}
+			if err := n.Decode(&r.values); err != nil {
+				return nil, err
+			}
+			if label, ok := r.values[labelKey]; ok {
+				r.label = fmt.Sprint(label)
+				delete(r.values, labelKey)
+			}
+			rows = append(rows, r)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			r := &row{label: node.Content[i].Value}
+			if err := node.Content[i+1].Decode(&r.values); err != nil {
+				return nil, err
+			}
+			rows = append(rows, r)
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!null" {
+			return nil, errors.New("rows must be a list or a mapping")
+		}
+	default:
+		return nil, errors.New("rows must be a list or a mapping")
+	}
+	return rows, nil
+}
+
+var refPattern = regexp.MustCompile(`ref\s+"([^".]+)\.`)
+
+// sortTables 按 ref 依赖排序, 无依赖关系的表保持添加顺序.
+func (f *Fixtures) sortTables() ([]*table, error) {
+	deps := make(map[string]map[string]bool, len(f.tables))
+	for _, t := range f.tables {
+		deps[t.name] = make(map[string]bool)
+		for _, r := range t.rows {
+			for _, v := range r.values {
+				s, ok := v.(string)
+				if !ok {
+					continue
+				}
+				for _, m := range refPattern.FindAllStringSubmatch(s, -1) {
+					if _, ok := f.index[m[1]]; ok && m[1] != t.name {
+						deps[t.name][m[1]] = true
+					}
+				}
+			}
+		}
+	}
+
+	sorted := make([]*table, 0, len(f.tables))
+	done := make(map[string]bool, len(f.tables))
+	for len(sorted) < len(f.tables) {
+		progressed := false
+		for _, t := range f.tables {
+			if done[t.name] {
+				continue
+			}
+			ready := true
+			for dep := range deps[t.name] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, t)
+				done[t.name] = true
+				progressed = true
+			}
+		}
+		if !progressed {
+			return nil, ErrCircularReference
+		}
+	}
+	return sorted, nil
+}
+
+// Insert 在事务中按依赖顺序插入全部行, 插入期间关闭外键检查.
+func (f *Fixtures) Insert(ctx context.Context) error {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	tables, err := f.sortTables()
+	if err != nil {
+		return err
+	}
+	f.rows = make(map[string]map[string]interface{})
+	funcs := f.funcs()
+	return f.p.Transaction(ctx, func(ctx context.Context) (err error) {
+		tx := f.p.UseWriteDB(db.AllowRawSQL(ctx)).Session(&gorm.Session{})
+		restore, err := disableForeignKeys(tx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if rerr := restore(); err == nil {
+				err = rerr
+			}
+		}()
+
+		// 表是否有自增主键, 按需查询.
+		autoIncrement := make(map[string]bool)
+
+		for _, t := range tables {
+			for _, r := range t.rows {
+				values, err := f.evaluate(funcs, r.values)
+				if err != nil {
+					return fmt.Errorf("fixtures: %s.%s: %w", t.name, r.label, err)
+				}
+				res := tx.Table(t.name).Create(values)
+				if res.Error != nil {
+					return fmt.Errorf("fixtures: insert %s.%s: %w", t.name, r.label, res.Error)
+				}
+				if r.label == "" {
+					continue
+				}
+				if _, ok := values[f.opts.IDColumn]; !ok && res.RowsAffected == 1 {
+					auto, ok := autoIncrement[t.name]
+					if !ok {
+						auto = f.hasAutoIncrementID(tx, t.name)
+						autoIncrement[t.name] = auto
+					}
+					// 无自增主键时 LAST_INSERT_ID 为之前插入的值, 不读取.
+					if auto {
+						if id, ok := lastInsertID(tx); ok {
+							values[f.opts.IDColumn] = id
+						}
+					}
+				}
+				f.rows[t.name+"."+r.label] = values
+			}
+		}
+		return nil
+	})
+}
+
+// Row 返回最近一次 Insert 插入的行, 包含生成的主键.
+func (f *Fixtures) Row(table, label string) map[string]interface{} {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.rows[table+"."+label]
+}
+
+// Truncate 清空表, 未指定时清空全部已添加的表.
+//
+// MySQL 的 TRUNCATE 会隐式提交事务, context 在事务内时使用 DELETE.
+func (f *Fixtures) Truncate(ctx context.Context, tables ...string) error {
+	if len(tables) == 0 {
+		f.mut.Lock()
+		for _, t := range f.tables {
+			tables = append(tables, t.name)
+		}
+		f.mut.Unlock()
+	}
+	useDelete := f.opts.UseDelete || inTransaction(f.p.UseWriteDB(ctx))
+	return f.p.Transaction(ctx, func(ctx context.Context) (err error) {
+		tx := f.p.UseWriteDB(db.AllowRawSQL(ctx)).Session(&gorm.Session{})
+		restore, err := disableForeignKeys(tx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if rerr := restore(); err == nil {
+				err = rerr
+			}
+		}()
+
+		for _, name := range tables {
+			var sql string
+			switch {
+			case useDelete, tx.Dialector.Name() == "sqlite":
+				sql = "DELETE FROM " + tx.Statement.Quote(name)
+			case tx.Dialector.Name() == "postgres":
+				sql = "TRUNCATE TABLE " + tx.Statement.Quote(name) + " RESTART IDENTITY CASCADE"
+			default:
+				sql = "TRUNCATE TABLE " + tx.Statement.Quote(name)
+			}
+			if err := tx.Exec(sql).Error; err != nil {
+				return fmt.Errorf("fixtures: truncate %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Reload 清空全部已添加的表后重新插入.
+func (f *Fixtures) Reload(ctx context.Context) error {
+	if err := f.Truncate(ctx); err != nil {
+		return err
+	}
+	return f.Insert(ctx)
+}
+
+func (f *Fixtures) funcs() template.FuncMap {
+	seqs := make(map[string]int)
+	now := func() string {
+		return f.opts.Now().Format(timeLayout)
+	}
+	offset := func(sign time.Duration) func(string) (string, error) {
+		return func(s string) (string, error) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return "", err
+			}
+			return f.opts.Now().Add(sign * d).Format(timeLayout), nil
+		}
+	}
+	return template.FuncMap{
+		"now":   now,
+		"ago":   offset(-1),
+		"later": offset(1),
+		"seq": func(name string) int {
+			seqs[name]++
+			return seqs[name]
+		},
+		"ref": func(path string) (interface{}, error) {
+			parts := strings.Split(path, ".")
+			if len(parts) == 2 {
+				parts = append(parts, f.opts.IDColumn)
+			}
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("invalid reference %q, want table.label[.column]", path)
+			}
+			values, ok := f.rows[parts[0]+"."+parts[1]]
+			if !ok {
+				return nil, fmt.Errorf("reference %q not inserted", path)
+			}
+			v, ok := values[parts[2]]
+			if !ok {
+				return nil, fmt.Errorf("reference %q has no column %s", path, parts[2])
+			}
+			return v, nil
+		},
+	}
+}
+
+// evaluate 求值模板, 对象与数组转换为 JSON.
+func (f *Fixtures) evaluate(funcs template.FuncMap, values map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(values))
+	for column, v := range values {
+		switch vv := v.(type) {
+		case string:
+			if !strings.Contains(vv, "{{") {
+				break
+			}
+			tmpl, err := template.New(column).Funcs(funcs).Option("missingkey=error").Parse(vv)
+			if err != nil {
+				return nil, err
+			}
+			var sb strings.Builder
+			if err := tmpl.Execute(&sb, nil); err != nil {
+				return nil, err
+			}
+			v = sb.String()
+		case map[string]interface{}, []interface{}:
+			data, err := json.Marshal(vv)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", column, err)
+			}
+			v = string(data)
+		}
+		result[column] = v
+	}
+	return result, nil
+}
+
+// inTransaction 判断 DB 是否为事务连接.
+func inTransaction(tx *gorm.DB) bool {
+	if tx == nil {
+		return false
+	}
+	_, ok := tx.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// disableForeignKeys 在当前连接关闭外键检查, 返回恢复函数.
+func disableForeignKeys(tx *gorm.DB) (func() error, error) {
+	var disable, enable string
+	switch tx.Dialector.Name() {
+	case "mysql":
+		disable, enable = "SET FOREIGN_KEY_CHECKS = 0", "SET FOREIGN_KEY_CHECKS = 1"
+	case "sqlite":
+		// 事务结束时自动恢复
+		disable = "PRAGMA defer_foreign_keys = ON"
+	case "postgres":
+		disable = "SET CONSTRAINTS ALL DEFERRED"
+	default:
+		return func() error { return nil }, nil
+	}
+	if err := tx.Exec(disable).Error; err != nil {
+		return nil, err
+	}
+	return func() error {
+		if enable == "" {
+			return nil
+		}
+		if err := tx.Exec(enable).Error; err != nil {
+			return fmt.Errorf("fixtures: restore foreign key checks: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// hasAutoIncrementID 判断表的 IDColumn 是否为自增列.
+func (f *Fixtures) hasAutoIncrementID(tx *gorm.DB, table string) bool {
+	columns, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return false
+	}
+	for _, column := range columns {
+		if column.Name() != f.opts.IDColumn {
+			continue
+		}
+		auto, ok := column.AutoIncrement()
+		return ok && auto
+	}
+	return false
+}
+
+// lastInsertID 读取当前连接最近生成的自增值.
+func lastInsertID(tx *gorm.DB) (int64, bool) {
+	var query string
+	switch tx.Dialector.Name() {
+	case "mysql":
+		query = "SELECT LAST_INSERT_ID()"
+	case "sqlite":
+		query = "SELECT last_insert_rowid()"
+	default:
+		return 0, false
+	}
+	var id int64
+	if err := tx.Raw(query).Scan(&id).Error; err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotInTransaction = errors.New("locking requires transaction context")
+	ErrLockTimeout      = errors.New("named lock acquire timeout")
+	ErrLockNotHeld      = errors.New("named lock not held by current transaction")
+)
+
+// 行锁强度.
+const (
+	LockingStrengthUpdate = "UPDATE"
+	LockingStrengthShare  = "SHARE"
+)
+
+// 行锁选项.
+const (
+	LockingOptionNoWait     = "NOWAIT"
+	LockingOptionSkipLocked = "SKIP LOCKED"
+)
+
+// ForUpdate 返回附加 SELECT ... FOR UPDATE 的 DB.
+//
+// 非事务上下文返回的 DB 携带 ErrNotInTransaction, 语句不会执行.
+func (p *TransProvider) ForUpdate(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthUpdate, "")
+}
+
+// ForUpdateNoWait 返回附加 SELECT ... FOR UPDATE NOWAIT 的 DB.
+func (p *TransProvider) ForUpdateNoWait(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthUpdate, LockingOptionNoWait)
+}
+
+// ForUpdateSkipLocked 返回附加 SELECT ... FOR UPDATE SKIP LOCKED 的 DB.
+func (p *TransProvider) ForUpdateSkipLocked(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthUpdate, LockingOptionSkipLocked)
+}
+
+// ForShare 返回附加 SELECT ... FOR SHARE 的 DB.
+func (p *TransProvider) ForShare(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthShare, "")
+}
+
+// ForShareNoWait 返回附加 SELECT ... FOR SHARE NOWAIT 的 DB.
+func (p *TransProvider) ForShareNoWait(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthShare, LockingOptionNoWait)
+}
+
+// ForShareSkipLocked 返回附加 SELECT ... FOR SHARE SKIP LOCKED 的 DB.
+func (p *TransProvider) ForShareSkipLocked(ctx context.Context) *gorm.DB {
+	return p.UseLockDB(ctx, LockingStrengthShare, LockingOptionSkipLocked)
+}
+
+// UseLockDB 返回附加行锁子句的事务 DB.
+//
+// 行锁只在事务内有意义, 自动提交连接上加锁会在语句结束时立即释放.
+// 非事务上下文返回的 DB 携带 ErrNotInTransaction.
+func (p *TransProvider) UseLockDB(ctx context.Context, strength, options string) *gorm.DB {
+	db := p.UseWriteDB(ctx)
+	if db == nil {
+		return nil
+	}
+	if !p.isInTransaction(ctx) {
+		_ = db.AddError(ErrNotInTransaction)
+		return db
+	}
+	return db.Clauses(clause.Locking{Strength: strength, Options: options})
+}
+
+// GetLock 获取 MySQL 命名锁 GET_LOCK, 锁的生命周期绑定到当前根事务.
+//
+// 首次调用时从写库连接池取出独立会话持有命名锁, 根事务结束(提交或回滚)后释放锁并归还会话,
+// 不使用命名锁的事务不额外占用连接. 连接池上限需为持锁会话预留连接, 否则会等待至 ctx 取消.
+// 连接池不是 *sql.DB 时在事务连接上持有命名锁, 于事务结束前释放.
+// 也可通过 ReleaseLock 提前释放. timeout 小于 0 时无限等待, 超时返回 ErrLockTimeout.
+func (p *TransProvider) GetLock(ctx context.Context, name string, timeout time.Duration) error {
+	if !p.isInTransaction(ctx) {
+		return ErrNotInTransaction
+	}
+	locks := p.namedLocksOf(p.findTransDB(ctx))
+	conn, err := locks.session(ctx, p.lookupDB(ctx, true))
+	if err != nil {
+		return err
+	}
+
+	seconds := -1.0
+	if timeout >= 0 {
+		seconds = timeout.Seconds()
+	}
+	var acquired sql.NullInt64
+	if conn != nil {
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, seconds).Scan(&acquired)
+	} else {
+		err = p.UseWriteDB(AllowRawSQL(ctx)).Raw("SELECT GET_LOCK(?, ?)", name, seconds).Scan(&acquired).Error
+	}
+	if err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return ErrLockTimeout
+	}
+	locks.add(name)
+	return nil
+}
+
+// ReleaseLock 提前释放当前事务持有的命名锁.
+func (p *TransProvider) ReleaseLock(ctx context.Context, name string) error {
+	if !p.isInTransaction(ctx) {
+		return ErrNotInTransaction
+	}
+	locks := p.namedLocksOf(p.findTransDB(ctx))
+	if !locks.remove(name) {
+		return ErrLockNotHeld
+	}
+	if conn := locks.conn(); conn != nil {
+		var released sql.NullInt64
+		return conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", name).Scan(&released)
+	}
+	return releaseNamedLock(p.UseWriteDB(AllowRawSQL(ctx)), name)
+}
+
+// releaseTxNamedLocks 在事务结束前释放事务连接上持有的命名锁.
+//
+// 命名锁由独立会话持有时不做处理, 由 releaseSessionNamedLocks 在事务结束后释放.
+func (p *TransProvider) releaseTxNamedLocks(tx *gorm.DB) {
+	v, ok := p.namedLocks.Load(tx)
+	if !ok || v.(*namedLocks).conn() != nil {
+		return
+	}
+	p.namedLocks.Delete(tx)
+	// context 取消后仍需释放, 否则锁会随连接留在连接池中.
+	db := tx.Session(&gorm.Session{Context: AllowRawSQL(context.WithoutCancel(tx.Statement.Context))})
+	for _, name := range v.(*namedLocks).names() {
+		_ = releaseNamedLock(db, name)
+	}
+}
+
+// releaseSessionNamedLocks 在事务提交或回滚后释放独立会话持有的命名锁并归还会话.
+//
+// 命名锁属于会话, 需在连接归还连接池前释放. 直接在连接上执行, 不经过 gorm 回调.
+func (p *TransProvider) releaseSessionNamedLocks(ctx context.Context, tx *gorm.DB) {
+	v, ok := p.namedLocks.LoadAndDelete(tx)
+	if !ok {
+		return
+	}
+	locks := v.(*namedLocks)
+	conn := locks.conn()
+	if conn == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, name := range locks.names() {
+		var released sql.NullInt64
+		_ = conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", name).Scan(&released)
+	}
+	_ = conn.Close()
+}
+
+// namedLocksOf 返回事务持有的命名锁, 以根事务 DB 为 key.
+func (p *TransProvider) namedLocksOf(tx *gorm.DB) *namedLocks {
+	v, _ := p.namedLocks.LoadOrStore(tx, &namedLocks{})
+	return v.(*namedLocks)
+}
+
+func releaseNamedLock(db *gorm.DB, name string) error {
+	var released sql.NullInt64
+	return db.Raw("SELECT RELEASE_LOCK(?)", name).Scan(&released).Error
+}
+
+// namedLocks 记录事务持有的命名锁.
+//
+// 同名锁可重入, 需释放相同次数.
+type namedLocks struct {
+	mut sync.Mutex
+	// 持有命名锁的独立会话, 首次 GetLock 时获取.
+	sess  *sql.Conn
+	locks []string
+}
+
+// session 返回持有命名锁的会话, 首次调用时从 db 的连接池获取.
+//
+// 连接池不是 *sql.DB 时返回 nil, 命名锁在事务连接上持有.
+func (l *namedLocks) session(ctx context.Context, db *gorm.DB) (*sql.Conn, error) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.sess != nil {
+		return l.sess, nil
+	}
+	pool, ok := db.Statement.ConnPool.(*sql.DB)
+	if !ok {
+		return nil, nil
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.sess = conn
+	return conn, nil
+}
+
+func (l *namedLocks) conn() *sql.Conn {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.sess
+}
+
+func (l *namedLocks) add(name string) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.locks = append(l.locks, name)
+}
+
+func (l *namedLocks) remove(name string) bool {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for i := len(l.locks) - 1; i >= 0; i-- {
+		if l.locks[i] == name {
+			l.locks = append(l.locks[:i], l.locks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *namedLocks) names() []string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	names := make([]string, len(l.locks))
+	copy(names, l.locks)
+	return names
+}
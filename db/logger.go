@@ -12,13 +12,71 @@ import (
 )
 
 type LoggerWrapper struct {
-	logger        slog.Logger
+	logger        *slog.Logger
 	SlowThreshold time.Duration
 	LogLevel      gormlogger.LogLevel
+
+	sqlf           *sqlFormatter
+	slowQueries    *SlowQueryRecorder
+	attrExtractors []LogAttrExtractor
+}
+
+// NewLoggerWrapper 创建 gorm 日志适配.
+// logger 为 nil 时使用 slog.Default().
+// sqlOpts 配置 SQL 日志专用 handler、脱敏、Info 级别采样与截断.
+func NewLoggerWrapper(logger *slog.Logger, slowThreshold time.Duration, logLevel gormlogger.LogLevel, sqlOpts ...*SQLLogOptions) *LoggerWrapper {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	l := &LoggerWrapper{logger: logger, SlowThreshold: slowThreshold, LogLevel: logLevel}
+	var opts *SQLLogOptions
+	if len(sqlOpts) > 0 {
+		opts = sqlOpts[0]
+	}
+	if opts != nil {
+		if opts.Handler != nil {
+			l.logger = slog.New(opts.Handler)
+		}
+		l.slowQueries = opts.SlowQueries
+		l.attrExtractors = opts.AttrExtractors
+	}
+	l.sqlf = newSQLFormatter(opts)
+	return l
+}
+
+// SlogLevel 转换 gorm 日志级别为 slog 级别.
+//
+// Silent 不输出, 返回高于 Error 的级别.
+func SlogLevel(level gormlogger.LogLevel) slog.Level {
+	switch {
+	case level >= gormlogger.Info:
+		return slog.LevelInfo
+	case level == gormlogger.Warn:
+		return slog.LevelWarn
+	case level == gormlogger.Error:
+		return slog.LevelError
+	default:
+		return slog.LevelError + 4
+	}
+}
+
+// GormLogLevel 转换 slog 级别为 gorm 日志级别.
+func GormLogLevel(level slog.Level) gormlogger.LogLevel {
+	switch {
+	case level > slog.LevelError:
+		return gormlogger.Silent
+	case level > slog.LevelWarn:
+		return gormlogger.Error
+	case level > slog.LevelInfo:
+		return gormlogger.Warn
+	default:
+		return gormlogger.Info
+	}
 }
 
-func NewLoggerWrapper(logger slog.Logger, slowThreshold time.Duration, logLevel gormlogger.LogLevel) *LoggerWrapper {
-	return &LoggerWrapper{logger: logger, SlowThreshold: slowThreshold, LogLevel: logLevel}
+// enabled 判断 gorm 日志级别与 handler 是否都允许输出.
+func (l *LoggerWrapper) enabled(ctx context.Context, level gormlogger.LogLevel) bool {
+	return l.LogLevel >= level && l.logger.Enabled(ctx, SlogLevel(level))
 }
 
 func (l *LoggerWrapper) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
@@ -28,20 +86,20 @@ func (l *LoggerWrapper) LogMode(level gormlogger.LogLevel) gormlogger.Interface
 }
 
 func (l *LoggerWrapper) Info(ctx context.Context, s string, i ...interface{}) {
-	if l.LogLevel >= gormlogger.Info {
-		l.logger.InfoContext(ctx, fmt.Sprintf(s, i...))
+	if l.enabled(ctx, gormlogger.Info) {
+		l.logger.Log(ctx, SlogLevel(gormlogger.Info), fmt.Sprintf(s, i...))
 	}
 }
 
 func (l *LoggerWrapper) Warn(ctx context.Context, s string, i ...interface{}) {
-	if l.LogLevel >= gormlogger.Warn {
-		l.logger.WarnContext(ctx, fmt.Sprintf(s, i...))
+	if l.enabled(ctx, gormlogger.Warn) {
+		l.logger.Log(ctx, SlogLevel(gormlogger.Warn), fmt.Sprintf(s, i...))
 	}
 }
 
 func (l *LoggerWrapper) Error(ctx context.Context, s string, i ...interface{}) {
-	if l.LogLevel >= gormlogger.Error {
-		l.logger.ErrorContext(ctx, fmt.Sprintf(s, i...))
+	if l.enabled(ctx, gormlogger.Error) {
+		l.logger.Log(ctx, SlogLevel(gormlogger.Error), fmt.Sprintf(s, i...))
 	}
 }
 
@@ -57,39 +115,59 @@ func (l *LoggerWrapper) Trace(
 
 	latency := time.Since(begin)
 	switch {
-	case err != nil && l.LogLevel >= gormlogger.Error && !errors.Is(err, gormlogger.ErrRecordNotFound):
+	case err != nil && l.enabled(ctx, gormlogger.Error) && !errors.Is(err, gormlogger.ErrRecordNotFound):
 		sql, rows := fc()
-		l.logger.ErrorContext(
-			ctx,
-			"sql execute error",
+		attrs := []any{
 			slog.Any("scene", "mysql_client"),
 			slog.Any("err", err),
 			slog.Any("latency", latency),
-			slog.Any("sql", sql),
+			slog.Any("sql", l.sqlf.format(sql)),
 			slog.Any("line", utils.FileWithLineNum()),
 			slog.Any("rows", rows),
-		)
-	case latency > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= gormlogger.Warn:
+		}
+		l.logger.Log(ctx, SlogLevel(gormlogger.Error), "sql execute error", l.withContextAttrs(ctx, attrs)...)
+	case latency > l.SlowThreshold && l.SlowThreshold != 0 && l.enabled(ctx, gormlogger.Warn):
 		sql, rows := fc()
-		l.logger.WarnContext(
-			ctx,
-			fmt.Sprintf("sql execute slow >= %v", l.SlowThreshold),
+		logSQL := l.sqlf.format(sql)
+		if l.slowQueries != nil {
+			l.slowQueries.record(sql, logSQL, latency)
+		}
+		attrs := []any{
 			slog.Any("scene", "mysql_client"),
 			slog.Any("latency", latency),
-			slog.Any("sql", sql),
+			slog.Any("sql", logSQL),
 			slog.Any("line", utils.FileWithLineNum()),
 			slog.Any("rows", rows),
-		)
-	case l.LogLevel == gormlogger.Info:
+		}
+		if plan := explainPlanFrom(ctx); plan != "" {
+			attrs = append(attrs, slog.Any("explain", plan))
+		}
+		l.logger.Log(ctx, SlogLevel(gormlogger.Warn), fmt.Sprintf("sql execute slow >= %v", l.SlowThreshold), l.withContextAttrs(ctx, attrs)...)
+	case l.enabled(ctx, gormlogger.Info) && l.sqlf.sampled():
 		sql, rows := fc()
-		l.logger.InfoContext(
-			ctx,
-			"sql execute",
+		attrs := []any{
 			slog.Any("scene", "mysql_client"),
 			slog.Any("latency", latency),
-			slog.Any("sql", sql),
+			slog.Any("sql", l.sqlf.format(sql)),
 			slog.Any("line", utils.FileWithLineNum()),
 			slog.Any("rows", rows),
-		)
+		}
+		l.logger.Log(ctx, SlogLevel(gormlogger.Info), "sql execute", l.withContextAttrs(ctx, attrs)...)
+	}
+}
+
+// withContextAttrs 附加执行信息与 context 提取的属性.
+func (l *LoggerWrapper) withContextAttrs(ctx context.Context, attrs []any) []any {
+	if info, ok := StmtInfoFromContext(ctx); ok {
+		attrs = append(attrs, slog.String("source", info.Source), slog.String("role", info.Role))
+		if info.Tx != "" {
+			attrs = append(attrs, slog.String("tx", info.Tx))
+		}
+	}
+	for _, extract := range l.attrExtractors {
+		for _, attr := range extract(ctx) {
+			attrs = append(attrs, attr)
+		}
 	}
+	return attrs
 }
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+)
+
+const stmtInfoPluginName = "driver:stmt_info"
+
+// 语句执行的库角色.
+const (
+	RoleWriter  = "writer"
+	RoleReplica = "replica"
+)
+
+// LogAttrExtractor 从 context 提取 SQL 日志属性, 如请求 ID、链路 ID、租户 ID.
+type LogAttrExtractor func(ctx context.Context) []slog.Attr
+
+// StmtInfo 语句执行信息, 由默认插件在执行前写入 context.
+type StmtInfo struct {
+	// 数据源名, 同 getWriteDBName/getReadDBName.
+	Source string
+	// 执行的库角色, RoleWriter 或 RoleReplica.
+	Role string
+	// 事务标识, 非事务为空. 同一事务内的语句相同.
+	// 仅标识 Transaction 或 db.Begin 开启的事务, 不含 gorm 默认为写语句开启的事务.
+	Tx string
+}
+
+type stmtInfoCtxKey struct{}
+
+// StmtInfoFromContext 返回 gorm 回调或 LoggerWrapper 中当前语句的执行信息.
+func StmtInfoFromContext(ctx context.Context) (*StmtInfo, bool) {
+	info, ok := ctx.Value(stmtInfoCtxKey{}).(*StmtInfo)
+	return info, ok
+}
+
+// stmtInfoPlugin 记录语句在哪个库、哪个事务执行.
+//
+// 在读写分离选库与开启事务后执行.
+type stmtInfoPlugin struct {
+	writeName string
+	readName  string
+	writePool gorm.ConnPool
+}
+
+func newStmtInfoPlugin(writeName string) *stmtInfoPlugin {
+	return &stmtInfoPlugin{writeName: writeName, readName: writeName}
+}
+
+func (p *stmtInfoPlugin) Name() string {
+	return stmtInfoPluginName
+}
+
+func (p *stmtInfoPlugin) Initialize(db *gorm.DB) error {
+	p.writePool = db.ConnPool
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(stmtInfoPluginName, p.record),
+		cb.Query().Before("gorm:query").Register(stmtInfoPluginName, p.record),
+		cb.Update().Before("gorm:update").Register(stmtInfoPluginName, p.record),
+		cb.Delete().Before("gorm:delete").Register(stmtInfoPluginName, p.record),
+		cb.Row().Before("gorm:row").Register(stmtInfoPluginName, p.record),
+		cb.Raw().Before("gorm:raw").Register(stmtInfoPluginName, p.record),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setReadName 设置从库名, 读写分离时注册.
+func (p *stmtInfoPlugin) setReadName(name string) {
+	p.readName = name
+}
+
+func (p *stmtInfoPlugin) record(db *gorm.DB) {
+	stmt := db.Statement
+	info := StmtInfo{Source: p.writeName, Role: RoleWriter}
+	connPool := stmt.ConnPool
+	if c, ok := connPool.(*commentConnPool); ok {
+		connPool = c.ConnPool
+	}
+	switch pool := connPool.(type) {
+	case gorm.TxCommitter:
+		// gorm 为单条写语句隐式开启的事务不视为事务.
+		if _, implicit := db.InstanceGet("gorm:started_transaction"); !implicit {
+			info.Tx = fmt.Sprintf("%p", pool)
+		}
+	case *gorm.PreparedStmtDB:
+		if pool.ConnPool != p.writePool {
+			info.Source, info.Role = p.readName, RoleReplica
+		}
+	default:
+		if pool != p.writePool {
+			info.Source, info.Role = p.readName, RoleReplica
+		}
+	}
+	stmt.Context = context.WithValue(stmt.Context, stmtInfoCtxKey{}, &info)
+}
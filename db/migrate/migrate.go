@@ -0,0 +1,336 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/tp-life/driver/db"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+var (
+	ErrLockTimeout      = errors.New("migration lock acquire timeout")
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrUnknownVersion   = errors.New("applied migration version not found")
+	ErrIrreversible     = errors.New("migration has no down step")
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+)
+
+// Options 迁移配置.
+type Options struct {
+	// 迁移历史表, 默认 schema_migrations.
+	Table string
+	// MySQL 命名锁名称, 默认 migrate.<Table>.
+	LockName string
+	// 获取命名锁超时时间, 默认 60 秒.
+	LockTimeout time.Duration
+	// 只输出待执行迁移, 不执行.
+	DryRun bool
+	// 跳过已执行迁移的校验和检查.
+	SkipVerify bool
+	Logger     *slog.Logger
+}
+
+// Record 迁移历史记录.
+type Record struct {
+	Version     int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name        string    `gorm:"size:255;not null"`
+	Checksum    string    `gorm:"size:64;not null"`
+	AppliedAt   time.Time `gorm:"not null"`
+	ExecutionMs int64     `gorm:"not null"`
+}
+
+// Status 迁移状态.
+type Status struct {
+	Migration *Migration
+	// 已执行时为历史记录, 否则为 nil.
+	Record *Record
+	// 已执行迁移内容是否被修改.
+	Modified bool
+}
+
+func (s *Status) version() int64 {
+	if s.Migration != nil {
+		return s.Migration.Version
+	}
+	return s.Record.Version
+}
+
+// Migrator 基于 TransProvider 写库执行版本迁移.
+//
+// 多副本同时启动时, 通过 MySQL 命名锁保证只有一个副本执行迁移.
+type Migrator struct {
+	provider   *db.TransProvider
+	migrations []*Migration
+	opts       Options
+}
+
+// New 创建迁移器.
+func New(provider *db.TransProvider, migrations []*Migration, optsList ...*Options) (*Migrator, error) {
+	var opts Options
+	if len(optsList) > 0 && optsList[0] != nil {
+		opts = *optsList[0]
+	}
+	if opts.Table == "" {
+		opts.Table = "schema_migrations"
+	}
+	if opts.LockName == "" {
+		opts.LockName = "migrate." + opts.Table
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = 60 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	sortMigrations(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicateVersion, sorted[i].Version)
+		}
+	}
+	return &Migrator{provider: provider, migrations: sorted, opts: opts}, nil
+}
+
+// writeDB 返回迁移使用的写库, 不应用 Provider 的全局 scope.
+func (m *Migrator) writeDB(ctx context.Context) *gorm.DB {
+	return m.provider.UseWriteDB(db.AllowRawSQL(ctx)).Session(&gorm.Session{NewDB: true}).Clauses(dbresolver.Write)
+}
+
+// Up 执行全部未执行的迁移, 返回已执行(DryRun 时为待执行)的迁移.
+//
+// 通常在服务启动时调用.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.withLock(ctx, func() error {
+		statuses, err := m.status(ctx)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(statuses); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.Record != nil || s.Migration == nil {
+				continue
+			}
+			if err := m.apply(ctx, s.Migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, s.Migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down 按版本倒序回滚 steps 个已执行的迁移, 返回已回滚(DryRun 时为待回滚)的迁移.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+	err := m.withLock(ctx, func() error {
+		statuses, err := m.status(ctx)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(statuses); err != nil {
+			return err
+		}
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			s := statuses[i]
+			if s.Record == nil {
+				continue
+			}
+			if !s.Migration.hasDown() {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, s.Migration.Version, s.Migration.Name)
+			}
+			if err := m.apply(ctx, s.Migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, s.Migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status 返回全部迁移状态, 按版本升序.
+func (m *Migrator) Status(ctx context.Context) ([]*Status, error) {
+	return m.status(ctx)
+}
+
+// Verify 校验已执行迁移与当前迁移是否一致.
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.status(ctx)
+	if err != nil {
+		return err
+	}
+	return m.verify(statuses)
+}
+
+func (m *Migrator) verify(statuses []*Status) error {
+	var errs []error
+	for _, s := range statuses {
+		switch {
+		case s.Migration == nil:
+			errs = append(errs, fmt.Errorf("%w: %d_%s", ErrUnknownVersion, s.Record.Version, s.Record.Name))
+		case s.Modified && !m.opts.SkipVerify:
+			errs = append(errs, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, s.Migration.Version, s.Migration.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Migrator) status(ctx context.Context) ([]*Status, error) {
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Record, len(records))
+	for _, r := range records {
+		byVersion[r.Version] = r
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := &Status{Migration: mig, Record: byVersion[mig.Version]}
+		if s.Record != nil {
+			s.Modified = s.Record.Checksum != mig.Checksum()
+			delete(byVersion, mig.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	// 已执行但当前不存在的迁移.
+	for _, r := range records {
+		if _, ok := byVersion[r.Version]; ok {
+			statuses = append(statuses, &Status{Record: r})
+		}
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].version() < statuses[j].version()
+	})
+	return statuses, nil
+}
+
+func (m *Migrator) records(ctx context.Context) ([]*Record, error) {
+	tx := m.writeDB(ctx)
+	if !tx.Migrator().HasTable(m.opts.Table) {
+		if m.opts.DryRun {
+			return nil, nil
+		}
+		if err := tx.Table(m.opts.Table).AutoMigrate(&Record{}); err != nil {
+			return nil, err
+		}
+	}
+	var records []*Record
+	if err := m.writeDB(ctx).Table(m.opts.Table).Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// apply 执行单个迁移并记录历史.
+//
+// MySQL DDL 会隐式提交, 迁移不在事务中执行, 失败时需人工处理已执行的语句.
+func (m *Migrator) apply(ctx context.Context, mig *Migration, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	logger := m.opts.Logger.With(
+		slog.String("scene", "migrate"),
+		slog.Int64("version", mig.Version),
+		slog.String("name", mig.Name),
+		slog.String("direction", direction),
+	)
+
+	sqlText, fn := mig.DownSQL, mig.Down
+	if up {
+		sqlText, fn = mig.UpSQL, mig.Up
+	}
+	if m.opts.DryRun {
+		if fn != nil {
+			logger.InfoContext(ctx, "migration planned (go)")
+		} else {
+			logger.InfoContext(ctx, "migration planned", slog.Any("sql", splitStatements(sqlText)))
+		}
+		return nil
+	}
+
+	begin := time.Now()
+	var err error
+	if fn != nil {
+		err = fn(ctx, m.writeDB(ctx))
+	} else {
+		for _, stmt := range splitStatements(sqlText) {
+			if err = m.writeDB(ctx).Exec(stmt).Error; err != nil {
+				err = fmt.Errorf("%s: %w", stmt, err)
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "migration failed", slog.Any("err", err))
+		return fmt.Errorf("migration %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	history := m.writeDB(ctx).Table(m.opts.Table)
+	if up {
+		err = history.Create(&Record{
+			Version:     mig.Version,
+			Name:        mig.Name,
+			Checksum:    mig.Checksum(),
+			AppliedAt:   time.Now(),
+			ExecutionMs: time.Since(begin).Milliseconds(),
+		}).Error
+	} else {
+		err = history.Where("version = ?", mig.Version).Delete(&Record{}).Error
+	}
+	if err != nil {
+		return err
+	}
+	logger.InfoContext(ctx, "migration applied", slog.Duration("latency", time.Since(begin)))
+	return nil
+}
+
+// withLock 持有 MySQL 命名锁执行 fn.
+//
+// 命名锁属于会话, 使用独立连接持有, 迁移语句仍由写库执行.
+// 非 MySQL 或 DryRun 时不加锁.
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	writer := m.writeDB(ctx)
+	if m.opts.DryRun || writer.Dialector.Name() != "mysql" {
+		return fn()
+	}
+	sqlDB, err := writer.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.opts.LockName, m.opts.LockTimeout.Seconds()).Scan(&acquired)
+	if err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return ErrLockTimeout
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.WithoutCancel(ctx), "DO RELEASE_LOCK(?)", m.opts.LockName)
+	}()
+	return fn()
+}
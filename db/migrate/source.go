@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Migration 代表一个版本迁移.
+//
+// SQL 迁移设置 UpSQL/DownSQL, Go 迁移设置 Up/Down, 同时设置时优先执行 Go 迁移.
+type Migration struct {
+	Version int64
+	Name    string
+
+	UpSQL   string
+	DownSQL string
+
+	Up   func(ctx context.Context, db *gorm.DB) error
+	Down func(ctx context.Context, db *gorm.DB) error
+}
+
+// Checksum 返回迁移内容校验和.
+//
+// 包含 UpSQL 与 DownSQL, Go 迁移无法计算内容, 仅校验版本与名称.
+func (m *Migration) Checksum() string {
+	h := sha256.New()
+	h.Write([]byte(strconv.FormatInt(m.Version, 10) + "_" + m.Name + "\n"))
+	h.Write([]byte(m.UpSQL))
+	// 长度前缀区分 up 与 down 的边界.
+	h.Write([]byte("\n" + strconv.Itoa(len(m.DownSQL)) + "\n"))
+	h.Write([]byte(m.DownSQL))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *Migration) hasDown() bool {
+	return m.Down != nil || strings.TrimSpace(m.DownSQL) != ""
+}
+
+// 文件名格式: <version>_<name>.up.sql / <version>_<name>.down.sql
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadFS 从文件系统目录加载 SQL 迁移, 通常配合 embed.FS 使用.
+func LoadFS(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.UpSQL = string(content)
+		} else {
+			m.DownSQL = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sortMigrations(migrations)
+	return migrations, nil
+}
+
+func sortMigrations(migrations []*Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// splitStatements 按分号拆分 SQL 语句, 忽略引号与注释中的分号.
+//
+// 普通注释被移除, /*! ... */ 版本注释由 MySQL 执行, 原样保留.
+//
+// 驱动默认不开启 multiStatements, 需逐条执行.
+func splitStatements(sql string) []string {
+	var (
+		stmts []string
+		buf   strings.Builder
+		quote byte
+	)
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		buf.Reset()
+	}
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' && i+1 < len(sql) {
+				i++
+				buf.WriteByte(sql[i])
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			buf.WriteByte(c)
+		case c == '-' && strings.HasPrefix(sql[i:], "-- "), c == '#':
+			// 行注释.
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			buf.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(sql[i:], "/*!"):
+			end := strings.Index(sql[i+3:], "*/")
+			if end < 0 {
+				buf.WriteString(sql[i:])
+				i = len(sql)
+			} else {
+				buf.WriteString(sql[i : i+end+5])
+				i += end + 4
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+			buf.WriteByte(' ')
+		case c == ';':
+			flush()
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	flush()
+	return stmts
+}
@@ -46,6 +46,7 @@ func (m *MysqlDBOpener) OpenDB(opts *Options, rOpts *RuntimeOptions) (*gorm.DB,
 			rOpts.Logger,
 			time.Duration(opts.SlowThreshold)*time.Millisecond,
 			logger.LogLevel(opts.LogLevel),
+			rOpts.SQLLog,
 		),
 		QueryFields:              true,
 		DisableNestedTransaction: true,
@@ -74,7 +75,15 @@ func (m *MysqlDBOpener) OpenDB(opts *Options, rOpts *RuntimeOptions) (*gorm.DB,
 
 func (m *MysqlDBOpener) registerPlugins(db *gorm.DB, opts *Options, rOpts *RuntimeOptions) error {
 	// 用户自定义插件
-	dbPlugins := rOpts.Plugins
+	dbPlugins := append([]gorm.Plugin{}, rOpts.Plugins...)
+	// 记录语句执行的库与事务, 用于日志属性
+	dbPlugins = append(dbPlugins, newStmtInfoPlugin(opts.fullName()))
+	if rOpts.SQLComment != nil {
+		dbPlugins = append(dbPlugins, newSQLCommentPlugin(rOpts.SQLComment))
+	}
+	if opts.ExplainSlow {
+		dbPlugins = append(dbPlugins, newExplainPlugin(time.Duration(opts.SlowThreshold)*time.Millisecond, opts.ExplainRate))
+	}
 
 	// 注册插件
 	for _, plugin := range dbPlugins {
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrStaleObject = errors.New("stale object: version mismatch")
+)
+
+// Version 乐观锁版本字段.
+//
+// 模型包含 Version 类型字段时, 按主键更新单个对象会附加 WHERE version = ?
+// 并将版本号加一, 未更新到记录时返回 ErrStaleObject.
+//
+// 例:
+//
+//	type Article struct {
+//		ID      int64
+//		Title   string
+//		Version db.Version
+//	}
+type Version int64
+
+const (
+	optimisticLockName       = "driver:optimistic_lock"
+	optimisticLockVersionKey = "driver:optimistic_lock_version"
+)
+
+var versionType = reflect.TypeOf(Version(0))
+
+// OptimisticLock 实现乐观锁的 gorm 插件.
+//
+// 通过 RuntimeOptions.Plugins 注册.
+type OptimisticLock struct{}
+
+// NewOptimisticLockPlugin 创建乐观锁插件.
+func NewOptimisticLockPlugin() *OptimisticLock {
+	return &OptimisticLock{}
+}
+
+func (p *OptimisticLock) Name() string {
+	return optimisticLockName
+}
+
+func (p *OptimisticLock) Initialize(db *gorm.DB) error {
+	cb := db.Callback().Update()
+	if err := cb.Before("gorm:update").Register(optimisticLockName+":before", p.beforeUpdate); err != nil {
+		return err
+	}
+	return cb.After("gorm:update").Register(optimisticLockName+":after", p.afterUpdate)
+}
+
+// beforeUpdate 附加版本条件并递增版本号.
+func (p *OptimisticLock) beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || stmt.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+	field := versionField(stmt.Schema)
+	if field == nil {
+		return
+	}
+	// 只对按主键更新的单个对象生效, 批量更新不附加版本条件.
+	for _, pf := range stmt.Schema.PrimaryFields {
+		if _, isZero := pf.ValueOf(stmt.Context, stmt.ReflectValue); isZero {
+			return
+		}
+	}
+
+	v, _ := field.ValueOf(stmt.Context, stmt.ReflectValue)
+	current := v.(Version)
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	if len(stmt.Selects) > 0 && !selected(stmt.Selects, field) {
+		stmt.Selects = append(stmt.Selects, field.DBName)
+	}
+	stmt.SetColumn(field.DBName, current+1, true)
+	// Dest 为 map 时 SetColumn 只写入 map, 同步更新模型的版本号.
+	if _, ok := stmt.Dest.(map[string]interface{}); ok && stmt.ReflectValue.CanAddr() {
+		_ = field.Set(stmt.Context, stmt.ReflectValue, current+1)
+	}
+	db.InstanceSet(optimisticLockVersionKey, current)
+}
+
+// afterUpdate 未更新到记录时返回 ErrStaleObject 并还原版本号.
+func (p *OptimisticLock) afterUpdate(db *gorm.DB) {
+	v, ok := db.InstanceGet(optimisticLockVersionKey)
+	if !ok {
+		return
+	}
+	if db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	field := versionField(db.Statement.Schema)
+	_ = field.Set(db.Statement.Context, db.Statement.ReflectValue, v)
+	_ = db.AddError(ErrStaleObject)
+}
+
+func versionField(s *schema.Schema) *schema.Field {
+	for _, field := range s.Fields {
+		if field.FieldType == versionType && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
+
+func selected(selects []string, field *schema.Field) bool {
+	for _, s := range selects {
+		if s == "*" || s == field.DBName || s == field.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type versionedArticle struct {
+	ID      int64
+	Title   string
+	Version Version
+}
+
+func TestOptimisticLockUpdates(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(db *gorm.DB, a *versionedArticle) error
+	}{
+		{"save", func(db *gorm.DB, a *versionedArticle) error {
+			return db.Save(a).Error
+		}},
+		{"updates map", func(db *gorm.DB, a *versionedArticle) error {
+			return db.Model(a).Updates(map[string]interface{}{"title": "b"}).Error
+		}},
+		{"select updates map", func(db *gorm.DB, a *versionedArticle) error {
+			return db.Model(a).Select("title").Updates(map[string]interface{}{"title": "b"}).Error
+		}},
+		{"update column", func(db *gorm.DB, a *versionedArticle) error {
+			return db.Model(a).Update("title", "b").Error
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, c := newFakeDB(t, NewOptimisticLockPlugin())
+			article := &versionedArticle{ID: 1, Title: "a", Version: 3}
+
+			if err := tt.update(db, article); err != nil {
+				t.Fatal(err)
+			}
+			if got := versionCondition(t, c); got != 3 {
+				t.Fatalf("version condition %d, want 3", got)
+			}
+			if article.Version != 4 {
+				t.Fatalf("version %d, want 4", article.Version)
+			}
+
+			// 同一对象再次保存使用递增后的版本号.
+			if err := db.Save(article).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got := versionCondition(t, c); got != 4 {
+				t.Fatalf("version condition %d, want 4", got)
+			}
+			if article.Version != 5 {
+				t.Fatalf("version %d, want 5", article.Version)
+			}
+		})
+	}
+}
+
+func TestOptimisticLockStale(t *testing.T) {
+	db, c := newFakeDB(t, NewOptimisticLockPlugin())
+	c.affected = 0
+	article := &versionedArticle{ID: 1, Title: "a", Version: 3}
+
+	err := db.Model(article).Updates(map[string]interface{}{"title": "b"}).Error
+	if !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("got %v, want ErrStaleObject", err)
+	}
+	if article.Version != 3 {
+		t.Fatalf("version %d, want 3 after stale update", article.Version)
+	}
+}
+
+// versionCondition 返回最后一条 UPDATE 的版本条件, 条件参数依次为版本号、主键.
+func versionCondition(t *testing.T, c *fakeConnector) int64 {
+	t.Helper()
+	exec := lastExec(t, c)
+	if !strings.Contains(exec.sql, "WHERE `versioned_articles`.`version` = ? AND `id` = ?") {
+		t.Fatalf("missing version condition: %s", exec.sql)
+	}
+	return exec.args[len(exec.args)-2].(int64)
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 	"gorm.io/plugin/dbresolver"
 )
 
@@ -45,13 +46,19 @@ type Options struct {
 	Tracing       bool `id:"mysql_tracing" json:"mysql_tracing" default:"false"` // 是否开启链路追踪
 	LogLevel      int  `id:"log_level" json:"log_level" default:"3"`             // 日志级别，默认为warning
 	SlowThreshold int  `id:"slow_threshold" json:"slow_threshold" default:"500"` // 慢查询阈值，单位：毫秒
+	ExplainSlow   bool `id:"explain_slow" json:"explain_slow" default:"false"`   // 慢 SELECT 是否采集执行计划
+	ExplainRate   int  `id:"explain_rate" json:"explain_rate" default:"1"`       // 每秒最多采集执行计划次数
 }
 
 // RuntimeOptions 不从配置文件加载，通常需要在代码中初始化的配置
 type RuntimeOptions struct {
-	Logger  slog.Logger
-	Plugins []gorm.Plugin             // gorm 插件，默认会有 Logger -> Metrics，不需要额外传
-	Scopes  []func(*gorm.DB) *gorm.DB // 全局 scope 函数
+	Logger      *slog.Logger              // 日志, 为 nil 使用 slog.Default()
+	Plugins     []gorm.Plugin             // gorm 插件，默认会有 Logger -> Metrics，不需要额外传
+	Scopes      []func(*gorm.DB) *gorm.DB // 全局 scope 函数
+	NamedScopes []NamedScope              // 具名全局 scope 函数, 在 Scopes 之后应用
+	SQLLog      *SQLLogOptions            // SQL 日志脱敏、采样、截断与附加属性
+	SQLComment  *SQLCommentOptions        // SQL 注释注入, 为 nil 不开启
+	Retry       *RetryOptions             // RetryTransaction 重试选项, 为 nil 使用默认值
 }
 
 // OpenDB 创建数据库连接.
@@ -81,6 +88,9 @@ func (o *RWOptions) openDB(opener DBOpener, rOpts *RuntimeOptions) (*gorm.DB, er
 	); err != nil {
 		return nil, err
 	}
+	if p, ok := db.Config.Plugins[stmtInfoPluginName].(*stmtInfoPlugin); ok {
+		p.setReadName(o.Read.fullName())
+	}
 	return db, nil
 }
 
@@ -90,6 +100,9 @@ func (o *RWOptions) ToSource(rOpts *RuntimeOptions) (Source, error) {
 }
 
 func (o *RWOptions) toSource(opener DBOpener, rOpts *RuntimeOptions) (Source, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
 	db, err := o.openDB(opener, rOpts)
 	if err != nil {
 		return nil, err
@@ -104,6 +117,9 @@ func (o *Options) ToSource(rOpts *RuntimeOptions) (Source, error) {
 }
 
 func (o *Options) toSource(opener DBOpener, rOpts *RuntimeOptions) (Source, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
 	db, err := opener.OpenDB(o, rOpts)
 	if err != nil {
 		return nil, err
@@ -117,3 +133,62 @@ func (o *Options) fullName() string {
 	}
 	return fmt.Sprintf("%s:%d/%s", o.Host, o.Port, o.Database)
 }
+
+// Validate 校验主从配置, 返回全部问题.
+func (o *RWOptions) Validate() error {
+	if o.Write == nil {
+		return ErrWriteDBNotConfigured
+	}
+	errs := o.Write.validate("write.")
+	if o.Read != nil {
+		errs = append(errs, o.Read.validate("read.")...)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 校验数据库配置, 返回全部问题.
+func (o *Options) Validate() error {
+	return errors.Join(o.validate("")...)
+}
+
+func (o *Options) validate(prefix string) []error {
+	var errs []error
+	invalid := func(id, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s%s: "+format, append([]interface{}{prefix, id}, args...)...))
+	}
+	if o.Host == "" {
+		invalid("mysql_host", "required")
+	}
+	if o.Port <= 0 || o.Port > 65535 {
+		invalid("mysql_port", "must be between 1 and 65535, got %d", o.Port)
+	}
+	if o.User == "" {
+		invalid("mysql_user", "required")
+	}
+	if o.Timeout < 0 {
+		invalid("mysql_conn_timeout", "must not be negative, got %d", o.Timeout)
+	}
+	if o.MaxOpen < 0 {
+		invalid("mysql_max_open", "must not be negative, got %d", o.MaxOpen)
+	}
+	if o.MaxIdle < 0 {
+		invalid("mysql_max_idle", "must not be negative, got %d", o.MaxIdle)
+	}
+	// MaxOpen 为 0 不限制连接数
+	if o.MaxOpen > 0 && o.MaxIdle > o.MaxOpen {
+		invalid("mysql_max_idle", "must not exceed mysql_max_open (%d), got %d", o.MaxOpen, o.MaxIdle)
+	}
+	if o.Lifetime < 0 {
+		invalid("mysql_conn_livetime", "must not be negative, got %d", o.Lifetime)
+	}
+	if o.LogLevel < 0 || o.LogLevel > int(logger.Info) {
+		invalid("log_level", "must be between 0 and %d, got %d", logger.Info, o.LogLevel)
+	}
+	if o.SlowThreshold < 0 {
+		invalid("slow_threshold", "must not be negative, got %d", o.SlowThreshold)
+	}
+	if o.ExplainRate < 0 {
+		invalid("explain_rate", "must not be negative, got %d", o.ExplainRate)
+	}
+	return errs
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrInvalidCursor   = errors.New("invalid pagination cursor")
+	ErrNullKeysetValue = errors.New("keyset pagination column value is null")
+)
+
+// OrderColumn 游标分页排序列.
+type OrderColumn struct {
+	// 列名或模型字段名.
+	Column string
+	// 是否降序.
+	Desc bool
+}
+
+// KeysetRequest 游标分页请求.
+//
+// Columns 组合需唯一确定一条记录, 通常以主键作为最后一列.
+// 排序列不支持 NULL, 边界记录的排序列为 NULL 时返回 ErrNullKeysetValue.
+type KeysetRequest struct {
+	Columns []OrderColumn
+	Limit   int
+	// 上次分页返回的 NextCursor 或 PrevCursor, 为空时查询第一页.
+	Cursor string
+}
+
+// KeysetPage 游标分页结果.
+type KeysetPage[T any] struct {
+	Items []*T
+	// 下一页游标, 无下一页时为空.
+	NextCursor string
+	// 上一页游标, 无上一页时为空.
+	PrevCursor string
+}
+
+// OffsetPage 偏移分页结果.
+type OffsetPage[T any] struct {
+	Items    []*T
+	Total    int64
+	Page     int
+	PageSize int
+}
+
+// cursor 游标内容, 按排序列顺序存储边界记录的值.
+type cursor struct {
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+func (c *cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := new(cursor)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// KeysetPaginate 对 db 执行游标分页查询.
+//
+// db 通常为 UseDB 返回并附加过滤条件的 DB, 不应再设置 Order/Limit/Offset.
+// 游标对调用方不透明, 排序列的值按模型字段类型解码.
+func KeysetPaginate[T any](db *gorm.DB, req KeysetRequest) (*KeysetPage[T], error) {
+	if len(req.Columns) == 0 || req.Limit <= 0 {
+		return nil, errors.New("keyset pagination requires columns and positive limit")
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	fields := make([]*schema.Field, len(req.Columns))
+	for i, col := range req.Columns {
+		field := stmt.Schema.LookUpField(col.Column)
+		if field == nil {
+			return nil, fmt.Errorf("keyset pagination column %q not found in %s", col.Column, stmt.Schema.Name)
+		}
+		fields[i] = field
+	}
+
+	var cur *cursor
+	if req.Cursor != "" {
+		var err error
+		if cur, err = decodeCursor(req.Cursor); err != nil {
+			return nil, err
+		}
+		if len(cur.Values) != len(fields) {
+			return nil, ErrInvalidCursor
+		}
+	}
+	backward := cur != nil && cur.Backward
+
+	tx := db.Model(new(T))
+	if cur != nil {
+		cond, err := keysetCondition(req.Columns, fields, cur)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Clauses(clause.Where{Exprs: []clause.Expression{cond}})
+	}
+	orderBy := clause.OrderBy{}
+	for i, col := range req.Columns {
+		orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: fields[i].DBName},
+			// 向前翻页时反向排序, 结果再翻转.
+			Desc: col.Desc != backward,
+		})
+	}
+
+	var items []*T
+	if err := tx.Clauses(orderBy).Limit(req.Limit + 1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	hasMore := len(items) > req.Limit
+	if hasMore {
+		items = items[:req.Limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	page := &KeysetPage[T]{Items: items}
+	if len(items) == 0 {
+		return page, nil
+	}
+	// 向后翻页时, 存在游标即存在上一页; 向前翻页时, 存在游标即存在下一页.
+	hasNext, hasPrev := hasMore, cur != nil
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	var err error
+	if hasNext {
+		if page.NextCursor, err = keysetCursor(db, fields, items[len(items)-1], false); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		if page.PrevCursor, err = keysetCursor(db, fields, items[0], true); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// keysetCondition 构造 (a > ?) OR (a = ? AND b > ?) ... 形式的游标条件.
+func keysetCondition(columns []OrderColumn, fields []*schema.Field, cur *cursor) (clause.Expression, error) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if string(cur.Values[i]) == "null" {
+			return nil, ErrInvalidCursor
+		}
+		v := reflect.New(field.FieldType)
+		if err := json.Unmarshal(cur.Values[i], v.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v.Elem().Interface()
+	}
+
+	ors := make([]clause.Expression, 0, len(fields))
+	for i := range fields {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: keysetColumn(fields[j]), Value: values[j]})
+		}
+		column := keysetColumn(fields[i])
+		if columns[i].Desc != cur.Backward {
+			ands = append(ands, clause.Lt{Column: column, Value: values[i]})
+		} else {
+			ands = append(ands, clause.Gt{Column: column, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	// 单个 OR 条件会以 OR 连接到已有条件上, 直接返回.
+	if len(ors) == 1 {
+		return ors[0], nil
+	}
+	return clause.Or(ors...), nil
+}
+
+func keysetColumn(field *schema.Field) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+}
+
+func keysetCursor[T any](db *gorm.DB, fields []*schema.Field, item *T, backward bool) (string, error) {
+	rv := reflect.ValueOf(item).Elem()
+	c := &cursor{Backward: backward, Values: make([]json.RawMessage, len(fields))}
+	for i, field := range fields {
+		v, _ := field.ValueOf(db.Statement.Context, rv)
+		c.Values[i], _ = json.Marshal(v)
+		if string(c.Values[i]) == "null" {
+			return "", fmt.Errorf("%w: %s", ErrNullKeysetValue, field.Name)
+		}
+	}
+	return c.encode(), nil
+}
+
+// OffsetPaginate 对 db 执行偏移分页查询并统计总数.
+//
+// page 从 1 开始.
+func OffsetPaginate[T any](db *gorm.DB, page, pageSize int) (*OffsetPage[T], error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		return nil, errors.New("offset pagination requires positive page size")
+	}
+	// 统计与查询共享条件, 互不影响.
+	tx := db.Model(new(T)).Session(&gorm.Session{})
+
+	result := &OffsetPage[T]{Page: page, PageSize: pageSize}
+	if err := tx.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if result.Total == 0 || int64((page-1)*pageSize) >= result.Total {
+		return result, nil
+	}
+	if err := tx.Offset((page - 1) * pageSize).Limit(pageSize).Find(&result.Items).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
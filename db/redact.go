@@ -0,0 +1,244 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue 脱敏后的替换值.
+const RedactedValue = "'***'"
+
+// SQLLogOptions 定义 SQL 日志脱敏、采样、截断与附加属性.
+type SQLLogOptions struct {
+	// SQL 日志专用 handler, 可单独配置级别与输出, 为 nil 使用 RuntimeOptions.Logger.
+	Handler slog.Handler
+	// 按列名脱敏, 匹配 `col` = 'v'、col IN (...) 及 INSERT 列值.
+	RedactColumns []string
+	// 按正则脱敏, 匹配内容替换为 '***'.
+	RedactPatterns []*regexp.Regexp
+	// 去除全部字面量, 只记录参数化 SQL.
+	Parameterize bool
+	// Info 级别 SQL 日志采样率, 取值 (0, 1), 其他值不采样.
+	InfoSampleRate float64
+	// SQL 最大长度, 超出部分截断, 0 不限制.
+	MaxSQLLength int
+	// 慢查询按指纹聚合, 为 nil 不聚合.
+	SlowQueries *SlowQueryRecorder
+	// 从 context 提取附加到每条 SQL 日志的属性.
+	AttrExtractors []LogAttrExtractor
+}
+
+// sqlFormatter 按 SQLLogOptions 处理待记录的 SQL.
+type sqlFormatter struct {
+	opts          SQLLogOptions
+	columnRegexp  *regexp.Regexp
+	redactColumns map[string]bool
+}
+
+func newSQLFormatter(opts *SQLLogOptions) *sqlFormatter {
+	if opts == nil {
+		return &sqlFormatter{}
+	}
+	f := &sqlFormatter{opts: *opts}
+	if len(opts.RedactColumns) > 0 {
+		names := make([]string, len(opts.RedactColumns))
+		f.redactColumns = make(map[string]bool, len(opts.RedactColumns))
+		for i, col := range opts.RedactColumns {
+			names[i] = regexp.QuoteMeta(col)
+			f.redactColumns[strings.ToLower(col)] = true
+		}
+		f.columnRegexp = regexp.MustCompile(
+			"(?i)(`?\\b(?:" + strings.Join(names, "|") + ")\\b`?\\s*(?:=|!=|<>|<=|>=|<|>|\\s+LIKE\\s+|\\s+IN\\s*)\\s*)" +
+				`('(?:[^'\\]|\\.|'')*'|-?\d+(?:\.\d+)?|\((?:[^()']|'(?:[^'\\]|\\.|'')*')*\))`,
+		)
+	}
+	return f
+}
+
+// sampled 返回 Info 级别日志是否记录.
+func (f *sqlFormatter) sampled() bool {
+	rate := f.opts.InfoSampleRate
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// format 返回脱敏、截断后的 SQL.
+func (f *sqlFormatter) format(sql string) string {
+	switch {
+	case f.opts.Parameterize:
+		sql = parameterizeSQL(sql)
+	case f.columnRegexp != nil:
+		sql = f.redactColumnValues(sql)
+		sql = f.redactInsertValues(sql)
+	}
+	for _, re := range f.opts.RedactPatterns {
+		sql = re.ReplaceAllString(sql, RedactedValue)
+	}
+	if max := f.opts.MaxSQLLength; max > 0 && len(sql) > max {
+		sql = fmt.Sprintf("%s...(truncated %d bytes)", sql[:max], len(sql)-max)
+	}
+	return sql
+}
+
+// redactColumnValues 脱敏 col = 'v'、col IN (...) 等条件及赋值中的值.
+func (f *sqlFormatter) redactColumnValues(sql string) string {
+	matches := f.columnRegexp.FindAllStringSubmatchIndex(sql, -1)
+	if matches == nil {
+		return sql
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(sql[last:m[3]])
+		if sql[m[4]] == '(' {
+			b.WriteString("(" + RedactedValue + ")")
+		} else {
+			b.WriteString(RedactedValue)
+		}
+		last = m[5]
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+var insertRegexp = regexp.MustCompile("(?is)^\\s*(?:INSERT|REPLACE)\\s+(?:IGNORE\\s+)?INTO\\s+[^(]+\\(([^)]*)\\)\\s*VALUES\\s*")
+
+// redactInsertValues 脱敏 INSERT ... (cols) VALUES (...),(...) 中指定列的值.
+func (f *sqlFormatter) redactInsertValues(sql string) string {
+	loc := insertRegexp.FindStringSubmatchIndex(sql)
+	if loc == nil {
+		return sql
+	}
+	columns := strings.Split(sql[loc[2]:loc[3]], ",")
+	redact := make([]bool, len(columns))
+	found := false
+	for i, col := range columns {
+		name := strings.ToLower(strings.Trim(strings.TrimSpace(col), "`\""))
+		redact[i] = f.redactColumns[name]
+		found = found || redact[i]
+	}
+	if !found {
+		return sql
+	}
+
+	var b strings.Builder
+	b.WriteString(sql[:loc[1]])
+	rest := sql[loc[1]:]
+	for first := true; ; first = false {
+		tuple := strings.TrimLeft(rest, " \n\t")
+		if !first {
+			if !strings.HasPrefix(tuple, ",") {
+				break
+			}
+			tuple = strings.TrimLeft(tuple[1:], " \n\t")
+		}
+		if !strings.HasPrefix(tuple, "(") {
+			break
+		}
+		values, n := splitTuple(tuple)
+		if n < 0 {
+			break
+		}
+		for i := range values {
+			if i < len(redact) && redact[i] {
+				values[i] = RedactedValue
+			}
+		}
+		if b.Len() > loc[1] {
+			b.WriteByte(',')
+		}
+		b.WriteString("(" + strings.Join(values, ",") + ")")
+		rest = tuple[n:]
+	}
+	b.WriteString(rest)
+	return b.String()
+}
+
+// splitTuple 拆分以 ( 开头的值列表, 返回各值及消耗的长度, 格式错误时长度为 -1.
+func splitTuple(s string) ([]string, int) {
+	var (
+		values []string
+		depth  int
+		quote  byte
+		start  = 1
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return append(values, strings.TrimSpace(s[start:i])), i + 1
+			}
+		case c == ',' && depth == 1:
+			values = append(values, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return nil, -1
+}
+
+// parameterizeSQL 将字符串和数字字面量替换为 ?.
+func parameterizeSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 跳过字符串字面量.
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\\' {
+					i++
+				} else if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+		case c == '`':
+			// 标识符原样保留.
+			end := strings.IndexByte(sql[i+1:], '`')
+			if end < 0 {
+				b.WriteString(sql[i:])
+				return b.String()
+			}
+			b.WriteString(sql[i : i+end+2])
+			i += end + 1
+		case isDigit(c) && (i == 0 || !isIdentChar(sql[i-1])):
+			for i+1 < len(sql) && (isDigit(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scope 查询条件, 同 gorm Scopes 参数.
+type Scope = func(*gorm.DB) *gorm.DB
+
+// Repository 基于 Provider 的通用模型仓储.
+//
+// 读操作使用 UseDB, 写操作使用 UseWriteDB,
+// 在事务上下文内自动使用事务 DB.
+type Repository[T any] struct {
+	provider Provider
+}
+
+// NewRepository 创建模型 T 的仓储.
+func NewRepository[T any](provider Provider) *Repository[T] {
+	return &Repository[T]{provider: provider}
+}
+
+func (r *Repository[T]) readDB(ctx context.Context) *gorm.DB {
+	return r.provider.UseDB(ctx).Model(new(T))
+}
+
+func (r *Repository[T]) writeDB(ctx context.Context) *gorm.DB {
+	return r.provider.UseWriteDB(ctx).Model(new(T))
+}
+
+// Get 按主键查询, 未找到返回 gorm.ErrRecordNotFound.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	entity := new(T)
+	if err := r.readDB(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Take(entity).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// FindBy 查询第一条满足条件的记录, 未找到返回 gorm.ErrRecordNotFound.
+//
+// 条件同 gorm Where, 如 FindBy(ctx, "email = ?", email).
+func (r *Repository[T]) FindBy(ctx context.Context, query interface{}, args ...interface{}) (*T, error) {
+	entity := new(T)
+	if err := r.readDB(ctx).Where(query, args...).Take(entity).Error; err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// List 查询满足全部过滤条件的记录.
+func (r *Repository[T]) List(ctx context.Context, filters ...Scope) ([]*T, error) {
+	var entities []*T
+	if err := r.readDB(ctx).Scopes(filters...).Find(&entities).Error; err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// Create 创建记录.
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return r.writeDB(ctx).Create(entity).Error
+}
+
+// BatchCreate 按 batchSize 分批创建记录, batchSize 小于等于 0 时一次写入.
+func (r *Repository[T]) BatchCreate(ctx context.Context, entities []*T, batchSize int) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = len(entities)
+	}
+	return r.writeDB(ctx).CreateInBatches(entities, batchSize).Error
+}
+
+// Update 按主键更新记录, 返回影响行数.
+//
+// fields 为更新字段掩码, 为空时更新全部字段(含零值).
+func (r *Repository[T]) Update(ctx context.Context, entity *T, fields ...string) (int64, error) {
+	db := r.writeDB(ctx).Model(entity)
+	if len(fields) == 0 {
+		db = db.Select("*")
+	} else {
+		db = db.Select(fields)
+	}
+	res := db.Updates(entity)
+	return res.RowsAffected, res.Error
+}
+
+// Delete 按主键删除记录, 返回影响行数.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) (int64, error) {
+	res := r.writeDB(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Delete(new(T))
+	return res.RowsAffected, res.Error
+}
+
+// Exists 判断是否存在满足全部过滤条件的记录.
+func (r *Repository[T]) Exists(ctx context.Context, filters ...Scope) (bool, error) {
+	var found []int
+	err := r.readDB(ctx).Scopes(filters...).Select("1").Limit(1).Find(&found).Error
+	if err != nil {
+		return false, err
+	}
+	return len(found) > 0, nil
+}
+
+// Count 统计满足全部过滤条件的记录数.
+func (r *Repository[T]) Count(ctx context.Context, filters ...Scope) (int64, error) {
+	var count int64
+	if err := r.readDB(ctx).Scopes(filters...).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
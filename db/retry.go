@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	gosql "github.com/go-sql-driver/mysql"
+)
+
+// 可重试的 MySQL 错误码.
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+)
+
+// defaultRetryBackoff 默认事务重试间隔.
+const defaultRetryBackoff = 10 * time.Millisecond
+
+// RetryOptions 事务重试选项.
+type RetryOptions struct {
+	// 重试间隔, 第 n 次重试等待 n 倍间隔. 小于等于 0 时使用 10ms.
+	Backoff time.Duration
+}
+
+func (o *RetryOptions) backoff() time.Duration {
+	if o == nil || o.Backoff <= 0 {
+		return defaultRetryBackoff
+	}
+	return o.Backoff
+}
+
+// IsRetryableError 判断事务错误是否可重试.
+//
+// 包括乐观锁冲突 ErrStaleObject, 死锁和锁等待超时.
+func IsRetryableError(err error) bool {
+	if errors.Is(err, ErrStaleObject) {
+		return true
+	}
+	var myErr *gosql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlErrDeadlock || myErr.Number == mysqlErrLockWaitTimeout
+	}
+	return false
+}
+
+// RetryTransaction 执行事务, 遇到可重试错误时整体重试, 最多执行 attempts 次.
+//
+// 嵌套在已有事务中时不重试, 错误交由根事务处理.
+// 回调可能被执行多次, 需保证除数据库操作外无副作用, 副作用使用 OnCommitted 注册.
+// 重试间隔由 RuntimeOptions.Retry 配置.
+func (p *TransProvider) RetryTransaction(ctx context.Context, attempts int, callback func(context.Context) error) error {
+	if p.isInTransaction(ctx) {
+		return p.Transaction(ctx, callback)
+	}
+
+	var err error
+	for i := 0; i < attempts || i == 0; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(time.Duration(i) * p.retryBackoff):
+			}
+		}
+		err = p.Transaction(ctx, callback)
+		if !IsRetryableError(err) {
+			return err
+		}
+	}
+	return err
+}
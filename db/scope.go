@@ -2,9 +2,17 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInjectValueMissing = errors.New("inject value missing in context")
 )
 
 // NewInjectFromContextScope 实现 context 进行 SQL 注入.
@@ -27,7 +35,159 @@ func NewInjectFromContextScope(field string, keyf func(context.Context) string,
 //
 // 从 context 读取值并注入 SQL 语句.
 //
-// 当 keyf 返回 value 为空 panic.
+// 当 keyf 返回 value 为空, 语句返回 ErrInjectValueMissing, 不会执行.
 func NewMustInjectFromContextScope(field string, keyf func(context.Context) string) func(*gorm.DB) *gorm.DB {
-	return NewInjectFromContextScope(field, keyf, false)
+	return NewInjectScope(InjectRule{
+		Field:    field,
+		Value:    ContextValue(keyf),
+		Required: true,
+	})
+}
+
+// InjectOperator 注入条件运算符.
+type InjectOperator string
+
+const (
+	OpEq      InjectOperator = "="
+	OpNeq     InjectOperator = "<>"
+	OpGt      InjectOperator = ">"
+	OpGte     InjectOperator = ">="
+	OpLt      InjectOperator = "<"
+	OpLte     InjectOperator = "<="
+	OpIn      InjectOperator = "IN"
+	OpNotIn   InjectOperator = "NOT IN"
+	OpBetween InjectOperator = "BETWEEN"
+)
+
+// InjectRule 定义从 context 注入的单个条件.
+type InjectRule struct {
+	// 字段名, 支持 table.column 限定表名.
+	// 未限定时使用当前表, 避免 JOIN 时字段歧义.
+	Field string
+	// 运算符, 默认 OpEq.
+	// OpIn/OpNotIn 的值需为切片, OpBetween 的值需为 Range.
+	Op InjectOperator
+	// 从 context 读取值, 返回 false 表示值缺失.
+	Value func(context.Context) (interface{}, bool)
+	// 值缺失时, true 语句返回 ErrInjectValueMissing, false 跳过该条件.
+	Required bool
+}
+
+// Range 代表 BETWEEN 区间, 包含两端.
+type Range[T any] struct {
+	From T
+	To   T
+}
+
+// NewInjectScope 按规则从 context 读取值并注入 SQL 条件, 多个规则为 AND 关系.
+func NewInjectScope(rules ...InjectRule) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		exprs := make([]clause.Expression, 0, len(rules))
+		for _, rule := range rules {
+			value, ok := rule.Value(db.Statement.Context)
+			if !ok {
+				if rule.Required {
+					_ = db.AddError(fmt.Errorf("%w: %s", ErrInjectValueMissing, rule.Field))
+				}
+				continue
+			}
+			expr, err := rule.expression(value)
+			if err != nil {
+				_ = db.AddError(err)
+				continue
+			}
+			exprs = append(exprs, expr)
+		}
+		if len(exprs) == 0 {
+			return db
+		}
+		return db.Clauses(clause.Where{Exprs: exprs})
+	}
+}
+
+func (r InjectRule) column() clause.Column {
+	if i := strings.LastIndexByte(r.Field, '.'); i >= 0 {
+		return clause.Column{Table: r.Field[:i], Name: r.Field[i+1:]}
+	}
+	return clause.Column{Table: clause.CurrentTable, Name: r.Field}
+}
+
+func (r InjectRule) expression(value interface{}) (clause.Expression, error) {
+	column := r.column()
+	switch r.Op {
+	case "", OpEq:
+		return clause.Eq{Column: column, Value: value}, nil
+	case OpNeq:
+		return clause.Neq{Column: column, Value: value}, nil
+	case OpGt:
+		return clause.Gt{Column: column, Value: value}, nil
+	case OpGte:
+		return clause.Gte{Column: column, Value: value}, nil
+	case OpLt:
+		return clause.Lt{Column: column, Value: value}, nil
+	case OpLte:
+		return clause.Lte{Column: column, Value: value}, nil
+	case OpIn, OpNotIn:
+		values, err := toSlice(value)
+		if err != nil {
+			return nil, fmt.Errorf("inject %s: %w", r.Field, err)
+		}
+		if r.Op == OpNotIn {
+			return clause.Not(clause.IN{Column: column, Values: values}), nil
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case OpBetween:
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Struct || !rv.FieldByName("From").IsValid() || !rv.FieldByName("To").IsValid() {
+			return nil, fmt.Errorf("inject %s: between requires Range value, got %T", r.Field, value)
+		}
+		return clause.Expr{
+			SQL:  "? BETWEEN ? AND ?",
+			Vars: []interface{}{column, rv.FieldByName("From").Interface(), rv.FieldByName("To").Interface()},
+		}, nil
+	default:
+		return nil, fmt.Errorf("inject %s: unsupported operator %q", r.Field, r.Op)
+	}
+}
+
+func toSlice(value interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("in requires slice value, got %T", value)
+	}
+	values := make([]interface{}, rv.Len())
+	for i := range values {
+		values[i] = rv.Index(i).Interface()
+	}
+	return values, nil
+}
+
+// ContextValue 包装读取单值的函数, 零值视为缺失.
+//
+// 适用于 string、int、uuid.UUID 等可比较类型.
+func ContextValue[T comparable](keyf func(context.Context) T) func(context.Context) (interface{}, bool) {
+	return func(ctx context.Context) (interface{}, bool) {
+		var zero T
+		v := keyf(ctx)
+		return v, v != zero
+	}
+}
+
+// ContextSlice 包装读取切片的函数, 用于 OpIn/OpNotIn, 空切片视为缺失.
+func ContextSlice[T any](keyf func(context.Context) []T) func(context.Context) (interface{}, bool) {
+	return func(ctx context.Context) (interface{}, bool) {
+		v := keyf(ctx)
+		return v, len(v) > 0
+	}
+}
+
+// ContextRange 包装读取区间的函数, 用于 OpBetween, 返回 nil 视为缺失.
+func ContextRange[T any](keyf func(context.Context) *Range[T]) func(context.Context) (interface{}, bool) {
+	return func(ctx context.Context) (interface{}, bool) {
+		v := keyf(ctx)
+		if v == nil {
+			return nil, false
+		}
+		return *v, true
+	}
 }
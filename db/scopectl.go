@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NamedScope 具名的全局 scope, 名称用于按 context 禁用.
+type NamedScope struct {
+	Name  string
+	Scope Scope
+}
+
+// scopeCondition 标记全局 scope 或插件附加的条件, 判断语句是否有条件时不计入.
+type scopeCondition struct {
+	clause.Expression
+}
+
+// hasConditions 判断语句是否包含调用方条件或模型主键条件.
+func hasConditions(stmt *gorm.Statement) bool {
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && !onlyScopeConditions(where.Exprs) {
+			return true
+		}
+	}
+	return len(primaryKeyConditions(stmt)) > 0
+}
+
+func onlyScopeConditions(exprs []clause.Expression) bool {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case scopeCondition:
+		case clause.AndConditions:
+			if !onlyScopeConditions(e.Exprs) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// scopeControl 保存 context 子树的 scope 控制.
+type scopeControl struct {
+	disableAll bool
+	disabled   map[string]bool
+	reasons    []string
+	scopes     []NamedScope
+}
+
+type scopeControlCtxKey struct{}
+
+func scopeControlFrom(ctx context.Context) scopeControl {
+	parent, _ := ctx.Value(scopeControlCtxKey{}).(*scopeControl)
+	if parent == nil {
+		return scopeControl{disabled: map[string]bool{}}
+	}
+	sc := scopeControl{
+		disableAll: parent.disableAll,
+		disabled:   make(map[string]bool, len(parent.disabled)),
+		reasons:    append([]string(nil), parent.reasons...),
+		scopes:     append([]NamedScope(nil), parent.scopes...),
+	}
+	for name := range parent.disabled {
+		sc.disabled[name] = true
+	}
+	return sc
+}
+
+// WithoutScopes 返回禁用 scope 的 context, 用于跨租户报表等管理任务.
+//
+// names 为空时禁用全部全局 scope, WithScopes 添加的 scope 需按名称禁用.
+// 使用禁用 scope 的 context 获取 DB 时, Provider 记录包含 reason 的日志.
+func WithoutScopes(ctx context.Context, reason string, names ...string) context.Context {
+	sc := scopeControlFrom(ctx)
+	if len(names) == 0 {
+		sc.disableAll = true
+	}
+	for _, name := range names {
+		sc.disabled[name] = true
+	}
+	sc.reasons = append(sc.reasons, reason)
+	return context.WithValue(ctx, scopeControlCtxKey{}, &sc)
+}
+
+// WithScopes 返回附加 scope 的 context, 在全局 scope 之后应用于该 context 子树的全部调用.
+func WithScopes(ctx context.Context, scopes ...NamedScope) context.Context {
+	sc := scopeControlFrom(ctx)
+	sc.scopes = append(sc.scopes, scopes...)
+	return context.WithValue(ctx, scopeControlCtxKey{}, &sc)
+}
+
+// ActiveScopes 返回 context 下生效的 scope 名称, 按应用顺序排列.
+func (p *TransProvider) ActiveScopes(ctx context.Context) []string {
+	scopes, _ := p.activeScopes(ctx)
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// activeScopes 返回生效的 scope 与被禁用的 scope 名称.
+func (p *TransProvider) activeScopes(ctx context.Context) (active []NamedScope, bypassed []string) {
+	sc, ok := ctx.Value(scopeControlCtxKey{}).(*scopeControl)
+	if !ok {
+		return p.scopes, nil
+	}
+	for _, s := range p.scopes {
+		if sc.disableAll || sc.disabled[s.Name] {
+			bypassed = append(bypassed, s.Name)
+			continue
+		}
+		active = append(active, s)
+	}
+	for _, s := range sc.scopes {
+		if sc.disabled[s.Name] {
+			bypassed = append(bypassed, s.Name)
+			continue
+		}
+		active = append(active, s)
+	}
+	return active, bypassed
+}
+
+// applyScopes 返回 context 下生效的 scope 函数, 存在禁用时记录日志.
+func (p *TransProvider) applyScopes(ctx context.Context) []func(*gorm.DB) *gorm.DB {
+	scopes, bypassed := p.activeScopes(ctx)
+	if len(bypassed) > 0 {
+		sc := ctx.Value(scopeControlCtxKey{}).(*scopeControl)
+		p.logger.WarnContext(
+			ctx,
+			"scopes bypassed",
+			slog.Any("scene", "scope"),
+			slog.Any("scopes", bypassed),
+			slog.Any("reason", sc.reasons),
+		)
+	}
+	fns := make([]func(*gorm.DB) *gorm.DB, len(scopes))
+	for i, s := range scopes {
+		fns[i] = s.Scope
+	}
+	return fns
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// (?, ?, ?) -> (?+)
+	fingerprintListRegexp = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	// VALUES (?+),(?+) -> VALUES (?+)
+	fingerprintValuesRegexp = regexp.MustCompile(`\(\?\+\)(?:\s*,\s*\(\?\+\))+`)
+	fingerprintSpaceRegexp  = regexp.MustCompile(`\s+`)
+)
+
+// Fingerprint 归一化 SQL, 字面量替换为 ?, IN 列表与多行 VALUES 合并.
+//
+// 相同结构、不同参数的语句得到相同指纹.
+func Fingerprint(sql string) string {
+	fp := parameterizeSQL(sql)
+	fp = fingerprintSpaceRegexp.ReplaceAllString(strings.TrimSpace(fp), " ")
+	fp = fingerprintListRegexp.ReplaceAllString(fp, "(?+)")
+	fp = fingerprintValuesRegexp.ReplaceAllString(fp, "(?+)")
+	return strings.ToLower(fp)
+}
+
+// SlowQueryStat 单个指纹的慢查询统计.
+type SlowQueryStat struct {
+	Fingerprint string        `json:"fingerprint"`
+	Sample      string        `json:"sample"`
+	Count       int64         `json:"count"`
+	Total       time.Duration `json:"total"`
+	Max         time.Duration `json:"max"`
+	LastSeen    time.Time     `json:"last_seen"`
+}
+
+// Avg 返回平均耗时.
+func (s *SlowQueryStat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s *SlowQueryStat) merge(o *SlowQueryStat) {
+	s.Count += o.Count
+	s.Total += o.Total
+	if o.Max > s.Max {
+		s.Max = o.Max
+	}
+	if o.LastSeen.After(s.LastSeen) {
+		s.LastSeen = o.LastSeen
+		s.Sample = o.Sample
+	}
+}
+
+// SlowQueryOrder 慢查询报告排序方式.
+type SlowQueryOrder int
+
+const (
+	OrderByTotal SlowQueryOrder = iota
+	OrderByCount
+	OrderByMax
+)
+
+// SlowQueryRecorder 按指纹在内存中聚合慢查询.
+//
+// 通过 SQLLogOptions.SlowQueries 注册到 LoggerWrapper, 只记录慢查询日志路径的语句.
+type SlowQueryRecorder struct {
+	mut sync.Mutex
+	// 启动以来累计.
+	total map[string]*SlowQueryStat
+	// 按 bucketWidth 分桶, 用于滑动窗口.
+	buckets     map[int64]map[string]*SlowQueryStat
+	bucketWidth time.Duration
+	retention   time.Duration
+	// 指纹数量上限, 超出后新指纹不再统计.
+	maxFingerprints int
+}
+
+// NewSlowQueryRecorder 创建慢查询聚合器.
+//
+// retention 为滑动窗口最大跨度, 默认 1 小时, 按分钟分桶.
+func NewSlowQueryRecorder(retention time.Duration) *SlowQueryRecorder {
+	if retention <= 0 {
+		retention = time.Hour
+	}
+	return &SlowQueryRecorder{
+		total:           make(map[string]*SlowQueryStat),
+		buckets:         make(map[int64]map[string]*SlowQueryStat),
+		bucketWidth:     time.Minute,
+		retention:       retention,
+		maxFingerprints: 1000,
+	}
+}
+
+// record 记录一条慢查询, sample 为日志中输出的 SQL.
+func (r *SlowQueryRecorder) record(sql, sample string, latency time.Duration) {
+	fp := Fingerprint(sql)
+	now := time.Now()
+	one := &SlowQueryStat{Fingerprint: fp, Sample: sample, Count: 1, Total: latency, Max: latency, LastSeen: now}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.total[fp]; !ok && len(r.total) >= r.maxFingerprints {
+		return
+	}
+	r.add(r.total, one)
+
+	key := now.Truncate(r.bucketWidth).Unix()
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = make(map[string]*SlowQueryStat)
+		r.buckets[key] = bucket
+		r.prune(now)
+	}
+	r.add(bucket, one)
+}
+
+func (r *SlowQueryRecorder) add(stats map[string]*SlowQueryStat, one *SlowQueryStat) {
+	if s, ok := stats[one.Fingerprint]; ok {
+		s.merge(one)
+		return
+	}
+	c := *one
+	stats[one.Fingerprint] = &c
+}
+
+// prune 清理超出保留时间的分桶.
+func (r *SlowQueryRecorder) prune(now time.Time) {
+	oldest := now.Add(-r.retention).Truncate(r.bucketWidth).Unix()
+	for key := range r.buckets {
+		if key < oldest {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// Top 返回耗时最高的 n 个指纹, n 小于等于 0 时返回全部.
+//
+// window 为 0 时统计启动以来全部慢查询, 否则统计最近 window 内(按分钟对齐, 不超过保留时间).
+func (r *SlowQueryRecorder) Top(n int, window time.Duration, order SlowQueryOrder) []SlowQueryStat {
+	r.mut.Lock()
+	merged := make(map[string]*SlowQueryStat)
+	if window <= 0 {
+		for fp, s := range r.total {
+			c := *s
+			merged[fp] = &c
+		}
+	} else {
+		since := time.Now().Add(-window).Truncate(r.bucketWidth).Unix()
+		for key, bucket := range r.buckets {
+			if key < since {
+				continue
+			}
+			for _, s := range bucket {
+				r.add(merged, s)
+			}
+		}
+	}
+	r.mut.Unlock()
+
+	stats := make([]SlowQueryStat, 0, len(merged))
+	for _, s := range merged {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		switch order {
+		case OrderByCount:
+			return stats[i].Count > stats[j].Count
+		case OrderByMax:
+			return stats[i].Max > stats[j].Max
+		default:
+			return stats[i].Total > stats[j].Total
+		}
+	})
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// Reset 清空统计.
+func (r *SlowQueryRecorder) Reset() {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.total = make(map[string]*SlowQueryStat)
+	r.buckets = make(map[int64]map[string]*SlowQueryStat)
+}
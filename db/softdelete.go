@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	softDeletePluginName = "driver:soft_delete"
+
+	// SoftDeleteScope 软删除过滤的 scope 名称, 可通过 WithoutScopes 禁用.
+	SoftDeleteScope = "soft_delete"
+)
+
+var (
+	ErrSoftDeleteNotConfigured = errors.New("soft delete not configured for model")
+	ErrSoftDeleteUnbound       = errors.New("soft delete plugin not registered to provider")
+	ErrPurgeUnsupported        = errors.New("purge requires timestamp soft delete")
+)
+
+// SoftDeleteMode 软删除标记方式.
+type SoftDeleteMode int
+
+const (
+	// SoftDeleteTimestamp 删除时写入当前时间, 未删除为 NULL.
+	SoftDeleteTimestamp SoftDeleteMode = iota
+	// SoftDeleteFlag 删除时写入 true, 未删除为 false.
+	SoftDeleteFlag
+)
+
+// SoftDeleteModel 配置单个模型的软删除.
+type SoftDeleteModel struct {
+	Model interface{}
+	Mode  SoftDeleteMode
+	// 标记列名, 默认 SoftDeleteTimestamp 为 deleted_at, SoftDeleteFlag 为 is_deleted.
+	Column string
+}
+
+type softDeleteRule struct {
+	model  *schema.Schema
+	mode   SoftDeleteMode
+	column string
+}
+
+// notDeleted 返回未删除条件.
+func (r *softDeleteRule) notDeleted() clause.Expression {
+	column := clause.Column{Table: clause.CurrentTable, Name: r.column}
+	if r.mode == SoftDeleteFlag {
+		return clause.Eq{Column: column, Value: false}
+	}
+	return clause.Eq{Column: column, Value: nil}
+}
+
+// deleted 返回已删除条件.
+func (r *softDeleteRule) deleted() clause.Expression {
+	column := clause.Column{Table: clause.CurrentTable, Name: r.column}
+	if r.mode == SoftDeleteFlag {
+		return clause.Eq{Column: column, Value: true}
+	}
+	return clause.Neq{Column: column, Value: nil}
+}
+
+func (r *softDeleteRule) deletedValue() interface{} {
+	if r.mode == SoftDeleteFlag {
+		return true
+	}
+	return time.Now()
+}
+
+func (r *softDeleteRule) restoredValue() interface{} {
+	if r.mode == SoftDeleteFlag {
+		return false
+	}
+	return nil
+}
+
+type (
+	includeDeletedCtxKey struct{}
+	hardDeleteCtxKey     struct{}
+)
+
+// IncludeDeleted 返回包含已软删除数据的 context.
+func IncludeDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedCtxKey{}, true)
+}
+
+// HardDelete 返回物理删除的 context, 配置软删除的模型执行 DELETE.
+func HardDelete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hardDeleteCtxKey{}, true)
+}
+
+func isIncludeDeleted(ctx context.Context) bool {
+	v, _ := ctx.Value(includeDeletedCtxKey{}).(bool)
+	return v
+}
+
+func isHardDelete(ctx context.Context) bool {
+	v, _ := ctx.Value(hardDeleteCtxKey{}).(bool)
+	return v
+}
+
+// SoftDelete 实现按模型配置的软删除.
+//
+// 作为 gorm 插件将删除改写为更新标记列, 注册后自动追加 SoftDeleteScope 到 Provider 的全局 scope,
+// 查询、更新、删除过滤已删除数据, 与租户等 scope 一同生效.
+// Unscoped 或 HardDelete 时执行物理删除, Unscoped 或 IncludeDeleted 时包含已删除数据.
+type SoftDelete struct {
+	models   []SoftDeleteModel
+	rules    map[string]*softDeleteRule
+	schemas  sync.Map
+	provider *TransProvider
+}
+
+// NewSoftDelete 创建软删除插件, 通过 RuntimeOptions.Plugins 注册.
+func NewSoftDelete(models ...SoftDeleteModel) *SoftDelete {
+	return &SoftDelete{models: models, rules: make(map[string]*softDeleteRule, len(models))}
+}
+
+func (s *SoftDelete) Name() string {
+	return softDeletePluginName
+}
+
+func (s *SoftDelete) Initialize(db *gorm.DB) error {
+	for _, m := range s.models {
+		sch, err := schema.Parse(m.Model, &s.schemas, db.NamingStrategy)
+		if err != nil {
+			return err
+		}
+		rule := &softDeleteRule{model: sch, mode: m.Mode, column: m.Column}
+		if rule.column == "" {
+			rule.column = "deleted_at"
+			if m.Mode == SoftDeleteFlag {
+				rule.column = "is_deleted"
+			}
+		}
+		if field := sch.LookUpField(rule.column); field != nil {
+			rule.column = field.DBName
+		}
+		s.rules[sch.Table] = rule
+	}
+
+	// 替换 gorm:delete, 在全部 Before 回调(如租户条件)之后改写语句.
+	cb := db.Callback().Delete()
+	del := cb.Get("gorm:delete")
+	if del == nil {
+		return fmt.Errorf("%s: gorm:delete callback not found", softDeletePluginName)
+	}
+	return cb.Replace("gorm:delete", func(db *gorm.DB) {
+		s.rewriteDelete(db)
+		del(db)
+	})
+}
+
+// cacheScope 返回查询缓存 key 的软删除片段.
+func (s *SoftDelete) cacheScope(ctx context.Context) string {
+	if isIncludeDeleted(ctx) {
+		return "all"
+	}
+	return ""
+}
+
+func (s *SoftDelete) bindProvider(p *TransProvider) {
+	s.provider = p
+	p.scopes = append(p.scopes, NamedScope{Name: SoftDeleteScope, Scope: s.scope})
+}
+
+// rule 返回语句对应表的软删除配置.
+func (s *SoftDelete) rule(stmt *gorm.Statement) *softDeleteRule {
+	if stmt.Table != "" {
+		return s.rules[stmt.Table]
+	}
+	model := stmt.Model
+	if model == nil {
+		model = stmt.Dest
+	}
+	if model == nil {
+		return nil
+	}
+	sch, err := schema.Parse(model, &s.schemas, stmt.NamingStrategy)
+	if err != nil {
+		return nil
+	}
+	return s.rules[sch.Table]
+}
+
+// scope 过滤已删除数据, 执行时模型尚未解析, 自行解析表名.
+func (s *SoftDelete) scope(db *gorm.DB) *gorm.DB {
+	stmt := db.Statement
+	if stmt.Unscoped || isIncludeDeleted(stmt.Context) {
+		return db
+	}
+	if rule := s.rule(stmt); rule != nil {
+		return db.Clauses(clause.Where{Exprs: []clause.Expression{scopeCondition{rule.notDeleted()}}})
+	}
+	return db
+}
+
+// rewriteDelete 将删除构造为 UPDATE 标记列, 由 gorm:delete 执行.
+func (s *SoftDelete) rewriteDelete(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.SQL.Len() > 0 || stmt.Unscoped || isHardDelete(stmt.Context) {
+		return
+	}
+	rule := s.rules[stmt.Table]
+	if rule == nil {
+		return
+	}
+	// 同 gorm:delete, 未删除条件不计入, 避免无条件删除标记全表.
+	if !db.AllowGlobalUpdate && !hasConditions(stmt) {
+		_ = db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+
+	if exprs := primaryKeyConditions(stmt); len(exprs) > 0 {
+		stmt.AddClause(clause.Where{Exprs: exprs})
+	}
+
+	stmt.AddClause(clause.Set{{Column: clause.Column{Name: rule.column}, Value: rule.deletedValue()}})
+	stmt.AddClauseIfNotExists(clause.Update{})
+	stmt.Build("UPDATE", "SET", "WHERE", "ORDER BY", "LIMIT")
+}
+
+// primaryKeyConditions 同 gorm:delete, 返回以模型主键为条件的表达式.
+func primaryKeyConditions(stmt *gorm.Statement) []clause.Expression {
+	if stmt.Schema == nil {
+		return nil
+	}
+	var exprs []clause.Expression
+	_, queryValues := schema.GetIdentityFieldValuesMap(stmt.Context, stmt.ReflectValue, stmt.Schema.PrimaryFields)
+	column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+	if len(values) > 0 {
+		exprs = append(exprs, clause.IN{Column: column, Values: values})
+	}
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		_, queryValues = schema.GetIdentityFieldValuesMap(stmt.Context, reflect.ValueOf(stmt.Model), stmt.Schema.PrimaryFields)
+		column, values = schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			exprs = append(exprs, clause.IN{Column: column, Values: values})
+		}
+	}
+	return exprs
+}
+
+// modelRule 返回模型的软删除配置.
+func (s *SoftDelete) modelRule(model interface{}) (*softDeleteRule, error) {
+	if s.provider == nil {
+		return nil, ErrSoftDeleteUnbound
+	}
+	sch, err := schema.Parse(model, &s.schemas, s.provider.getWriteDB(context.Background()).NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+	rule, ok := s.rules[sch.Table]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSoftDeleteNotConfigured, sch.Table)
+	}
+	return rule, nil
+}
+
+// Restore 恢复已软删除的数据, 返回恢复的行数.
+//
+// model 包含主键时按主键恢复, query 为 nil 或空字符串且 model 无主键时返回 gorm.ErrMissingWhereClause.
+func (s *SoftDelete) Restore(ctx context.Context, model interface{}, query interface{}, args ...interface{}) (int64, error) {
+	rule, err := s.modelRule(model)
+	if err != nil {
+		return 0, err
+	}
+	if isEmptyQuery(query) {
+		_, values := schema.GetIdentityFieldValuesMap(ctx, reflect.Indirect(reflect.ValueOf(model)), rule.model.PrimaryFields)
+		if len(values) == 0 {
+			return 0, gorm.ErrMissingWhereClause
+		}
+		query = nil
+	}
+	db := s.provider.UseWriteDB(IncludeDeleted(ctx)).Model(model).Clauses(clause.Where{Exprs: []clause.Expression{rule.deleted()}})
+	if query != nil {
+		db = db.Where(query, args...)
+	}
+	result := db.Update(rule.column, rule.restoredValue())
+	return result.RowsAffected, result.Error
+}
+
+func isEmptyQuery(query interface{}) bool {
+	switch q := query.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(q) == ""
+	}
+	return false
+}
+
+// Purge 分批物理删除软删除时间早于 retention 的数据, 返回删除的行数.
+//
+// 每批为独立语句, 不在事务中执行, 避免长时间持有锁. 仅支持 SoftDeleteTimestamp.
+func (s *SoftDelete) Purge(ctx context.Context, model interface{}, retention time.Duration, batchSize int) (int64, error) {
+	rule, err := s.modelRule(model)
+	if err != nil {
+		return 0, err
+	}
+	if rule.mode != SoftDeleteTimestamp {
+		return 0, fmt.Errorf("%w: %s", ErrPurgeUnsupported, rule.model.Table)
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	before := time.Now().Add(-retention)
+	ctx = HardDelete(IncludeDeleted(ctx))
+	var purged int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		result := s.provider.UseWriteDB(ctx).
+			Where(clause.Lt{Column: clause.Column{Table: clause.CurrentTable, Name: rule.column}, Value: before}).
+			Limit(batchSize).
+			Delete(reflect.New(rule.model.ModelType).Interface())
+		if result.Error != nil {
+			return purged, result.Error
+		}
+		purged += result.RowsAffected
+		if result.RowsAffected < int64(batchSize) {
+			return purged, nil
+		}
+	}
+}
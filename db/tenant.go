@@ -0,0 +1,428 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	tenantPluginName = "driver:tenant"
+	tenantUpsertKey  = "driver:tenant_upsert"
+)
+
+var (
+	ErrTenantMissing  = errors.New("tenant missing in context")
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	ErrTenantRawSQL   = errors.New("raw sql is not allowed under tenant isolation")
+	// 未解析模型的语句作用于未注册的表, 无法判断是否需要隔离.
+	ErrTenantUnknownTable = errors.New("statement without model on table not registered for tenant isolation")
+)
+
+type (
+	allowRawSQLCtxKey  struct{}
+	tenantBypassCtxKey struct{}
+)
+
+// AllowRawSQL 标记 context 允许执行原生 SQL.
+//
+// 租户隔离无法分析原生 SQL, 调用方需自行保证 SQL 包含租户条件.
+func AllowRawSQL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowRawSQLCtxKey{}, true)
+}
+
+func isRawSQLAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(allowRawSQLCtxKey{}).(bool)
+	return allowed
+}
+
+// TenantOptions 租户隔离配置.
+type TenantOptions struct {
+	// 租户列名, 默认 tenant_id. 模型不包含该列时不做隔离.
+	Column string
+	// 从 context 读取租户, 返回 false 表示缺失.
+	Tenant func(ctx context.Context) (interface{}, bool)
+	// 包含租户列的模型, 未解析模型的语句(如 Table 与 map 结果)按表名隔离.
+	// 未解析模型的查询、更新、删除作用于未注册且未排除的表时返回 ErrTenantUnknownTable.
+	Models []interface{}
+	// 不做隔离的表.
+	ExcludeTables []string
+	// 记录绕过隔离的审计日志, 默认 slog.Default().
+	Logger *slog.Logger
+}
+
+// TenantPlugin 实现租户隔离的 gorm 插件.
+//
+// 创建时自动填充租户列, 查询、更新、删除自动附加租户条件,
+// upsert 不更新租户列, 冲突行属于其他租户时不做更新,
+// 未标记 AllowRawSQL 的原生 SQL 被拒绝, context 缺少租户时语句返回 ErrTenantMissing.
+// 与 gorm 相同, 无条件的更新、删除返回 gorm.ErrMissingWhereClause, 租户条件不计入.
+// 管理任务通过 Bypass 绕过隔离, 绕过时记录审计日志.
+type TenantPlugin struct {
+	opts     TenantOptions
+	excluded map[string]bool
+	// Models 注册的表与租户列.
+	tables  map[string]string
+	schemas sync.Map
+}
+
+// NewTenantPlugin 创建租户隔离插件, 通过 RuntimeOptions.Plugins 注册.
+func NewTenantPlugin(opts TenantOptions) *TenantPlugin {
+	if opts.Column == "" {
+		opts.Column = "tenant_id"
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	p := &TenantPlugin{
+		opts:     opts,
+		excluded: make(map[string]bool, len(opts.ExcludeTables)),
+		tables:   make(map[string]string, len(opts.Models)),
+	}
+	for _, table := range opts.ExcludeTables {
+		p.excluded[table] = true
+	}
+	return p
+}
+
+func (p *TenantPlugin) Name() string {
+	return tenantPluginName
+}
+
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	for _, m := range p.opts.Models {
+		sch, err := schema.Parse(m, &p.schemas, db.NamingStrategy)
+		if err != nil {
+			return err
+		}
+		field := sch.LookUpField(p.opts.Column)
+		if field == nil {
+			return fmt.Errorf("%s: model %s has no tenant column %s", tenantPluginName, sch.Name, p.opts.Column)
+		}
+		p.tables[sch.Table] = field.DBName
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(tenantPluginName, p.beforeCreate),
+		cb.Query().Before("gorm:query").Register(tenantPluginName, p.beforeQuery),
+		cb.Update().Before("gorm:update").Register(tenantPluginName, p.beforeUpdate),
+		cb.Delete().Before("gorm:delete").Register(tenantPluginName, p.beforeDelete),
+		cb.Row().Before("gorm:row").Register(tenantPluginName, p.beforeQuery),
+		cb.Raw().Before("gorm:raw").Register(tenantPluginName, p.beforeRaw),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	if db.ClauseBuilders == nil {
+		db.ClauseBuilders = make(map[string]clause.ClauseBuilder)
+	}
+	db.ClauseBuilders["ON CONFLICT"] = p.buildOnConflict(db.ClauseBuilders["ON CONFLICT"], db.Dialector.Name() == "mysql")
+	return nil
+}
+
+// Bypass 返回绕过租户隔离的 context, 并记录调用位置与原因.
+//
+// 仅用于跨租户的管理任务, 原生 SQL 仍需 AllowRawSQL.
+func (p *TenantPlugin) Bypass(ctx context.Context, reason string) context.Context {
+	_, file, line, _ := runtime.Caller(1)
+	p.opts.Logger.WarnContext(
+		ctx,
+		"tenant isolation bypassed",
+		slog.Any("scene", "tenant"),
+		slog.Any("reason", reason),
+		slog.Any("line", fmt.Sprintf("%s:%d", file, line)),
+	)
+	return context.WithValue(ctx, tenantBypassCtxKey{}, reason)
+}
+
+func isTenantBypassed(ctx context.Context) bool {
+	_, ok := ctx.Value(tenantBypassCtxKey{}).(string)
+	return ok
+}
+
+// cacheScope 返回查询缓存 key 的租户片段.
+func (p *TenantPlugin) cacheScope(ctx context.Context) string {
+	if isTenantBypassed(ctx) {
+		return "*"
+	}
+	tenant, ok := p.opts.Tenant(ctx)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(tenant)
+}
+
+// field 返回需要隔离的模型租户字段, 无需隔离或未解析模型时返回 nil.
+func (p *TenantPlugin) field(db *gorm.DB) *schema.Field {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil || p.excluded[stmt.Table] || isTenantBypassed(stmt.Context) {
+		return nil
+	}
+	return stmt.Schema.LookUpField(p.opts.Column)
+}
+
+// column 返回需要隔离的租户列名, 无需隔离时返回空.
+//
+// 模型不含租户列时按 Models 注册的表名匹配.
+// strict 为 true 时, 未解析模型且表未注册的语句返回 ErrTenantUnknownTable.
+func (p *TenantPlugin) column(db *gorm.DB, strict bool) string {
+	stmt := db.Statement
+	if db.Error != nil || p.excluded[stmt.Table] || isTenantBypassed(stmt.Context) {
+		return ""
+	}
+	if field := p.field(db); field != nil {
+		return field.DBName
+	}
+	if column, ok := p.tables[stmt.Table]; ok {
+		return column
+	}
+	if strict && stmt.Schema == nil && stmt.Table != "" {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrTenantUnknownTable, stmt.Table))
+	}
+	return ""
+}
+
+func (p *TenantPlugin) tenant(db *gorm.DB) (interface{}, bool) {
+	tenant, ok := p.opts.Tenant(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrTenantMissing, db.Statement.Table))
+	}
+	return tenant, ok
+}
+
+// rejectRawSQL 拒绝已构造好 SQL 的原生语句.
+func (p *TenantPlugin) rejectRawSQL(db *gorm.DB) bool {
+	if db.Statement.SQL.Len() == 0 || isRawSQLAllowed(db.Statement.Context) {
+		return false
+	}
+	_ = db.AddError(ErrTenantRawSQL)
+	return true
+}
+
+func (p *TenantPlugin) beforeRaw(db *gorm.DB) {
+	if db.Error == nil {
+		p.rejectRawSQL(db)
+	}
+}
+
+func (p *TenantPlugin) beforeQuery(db *gorm.DB) {
+	if db.Error != nil || p.rejectRawSQL(db) {
+		return
+	}
+	column := p.column(db, true)
+	if column == "" {
+		return
+	}
+	if tenant, ok := p.tenant(db); ok {
+		p.where(db, column, tenant)
+	}
+}
+
+func (p *TenantPlugin) beforeDelete(db *gorm.DB) {
+	if db.Error != nil || p.rejectRawSQL(db) {
+		return
+	}
+	column := p.column(db, true)
+	if column == "" || !p.requireConditions(db) {
+		return
+	}
+	if tenant, ok := p.tenant(db); ok {
+		p.where(db, column, tenant)
+	}
+}
+
+// requireConditions 在附加租户条件前检查语句条件, 避免租户条件使 gorm 的全表检查失效.
+func (p *TenantPlugin) requireConditions(db *gorm.DB) bool {
+	if db.AllowGlobalUpdate || db.Statement.SQL.Len() > 0 || hasConditions(db.Statement) {
+		return true
+	}
+	_ = db.AddError(gorm.ErrMissingWhereClause)
+	return false
+}
+
+func (p *TenantPlugin) beforeUpdate(db *gorm.DB) {
+	if db.Error != nil || p.rejectRawSQL(db) {
+		return
+	}
+	column := p.column(db, true)
+	if column == "" || !p.requireConditions(db) {
+		return
+	}
+	tenant, ok := p.tenant(db)
+	if !ok {
+		return
+	}
+	field := p.field(db)
+	// 不允许更新为其他租户.
+	if dest, ok := db.Statement.Dest.(map[string]interface{}); ok {
+		keys := []string{column}
+		if field != nil {
+			keys = append(keys, field.Name)
+		}
+		for _, key := range keys {
+			if v, ok := dest[key]; ok && !sameTenant(v, tenant) {
+				_ = db.AddError(fmt.Errorf("%w: update %s to %v", ErrTenantMismatch, column, v))
+				return
+			}
+		}
+	} else if field != nil {
+		if err := p.fill(db, field, tenant); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+	}
+	p.where(db, column, tenant)
+}
+
+func (p *TenantPlugin) beforeCreate(db *gorm.DB) {
+	if db.Error != nil || p.rejectRawSQL(db) {
+		return
+	}
+	column := p.column(db, false)
+	if column == "" {
+		return
+	}
+	tenant, ok := p.tenant(db)
+	if !ok {
+		return
+	}
+	if _, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		db.InstanceSet(tenantUpsertKey, tenantGuard{column: column, tenant: tenant})
+	}
+	var dests []map[string]interface{}
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		dests = []map[string]interface{}{dest}
+	case []map[string]interface{}:
+		dests = dest
+	case *[]map[string]interface{}:
+		dests = *dest
+	default:
+		if field := p.field(db); field != nil {
+			if err := p.fill(db, field, tenant); err != nil {
+				_ = db.AddError(err)
+			}
+		}
+		return
+	}
+	for _, dest := range dests {
+		if v, ok := dest[column]; ok && !sameTenant(v, tenant) {
+			_ = db.AddError(fmt.Errorf("%w: create with %s %v", ErrTenantMismatch, column, v))
+			return
+		}
+	}
+	for _, dest := range dests {
+		dest[column] = tenant
+	}
+}
+
+// buildOnConflict 为租户表的 upsert 附加租户保护, 由 gorm 展开 UpdateAll 后构造子句时调用.
+func (p *TenantPlugin) buildOnConflict(next clause.ClauseBuilder, mysql bool) clause.ClauseBuilder {
+	return func(c clause.Clause, builder clause.Builder) {
+		if stmt, ok := builder.(*gorm.Statement); ok {
+			onConflict, ok := c.Expression.(clause.OnConflict)
+			if guard, guarded := stmt.DB.InstanceGet(tenantUpsertKey); guarded && ok {
+				c.Expression = guard.(tenantGuard).apply(onConflict, mysql)
+			}
+		}
+		if next != nil {
+			next(c, builder)
+		} else {
+			c.Build(builder)
+		}
+	}
+}
+
+// tenantGuard upsert 的租户保护.
+type tenantGuard struct {
+	column string
+	tenant interface{}
+}
+
+// apply 移除租户列的更新, 冲突行属于其他租户时不更新.
+//
+// MySQL 的 ON DUPLICATE KEY UPDATE 不支持条件, 每列以 IF(tenant_id = ?, 新值, 原值) 赋值;
+// 其他方言附加 DO UPDATE ... WHERE 租户条件.
+func (g tenantGuard) apply(onConflict clause.OnConflict, mysql bool) clause.OnConflict {
+	if onConflict.DoNothing && len(onConflict.DoUpdates) == 0 {
+		return onConflict
+	}
+	column := clause.Column{Name: g.column}
+	set := make(clause.Set, 0, len(onConflict.DoUpdates))
+	for _, assignment := range onConflict.DoUpdates {
+		if assignment.Column.Name == g.column {
+			continue
+		}
+		if mysql {
+			value := assignment.Value
+			if c, ok := value.(clause.Column); ok && c.Table == "excluded" {
+				value = clause.Expr{SQL: "VALUES(?)", Vars: []interface{}{clause.Column{Name: c.Name}}}
+			}
+			assignment.Value = clause.Expr{SQL: "IF(? = ?, ?, ?)", Vars: []interface{}{column, g.tenant, value, assignment.Column}}
+		}
+		set = append(set, assignment)
+	}
+	if len(set) == 0 {
+		// 仅更新租户列时改为不更新的赋值.
+		set = clause.Set{{Column: column, Value: column}}
+	}
+	onConflict.DoUpdates = set
+	if !mysql {
+		onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: g.column}, Value: g.tenant})
+	}
+	return onConflict
+}
+
+// fill 为零值的租户字段填充当前租户, 非零且不一致时返回错误.
+func (p *TenantPlugin) fill(db *gorm.DB, field *schema.Field, tenant interface{}) error {
+	stmt := db.Statement
+	check := func(rv reflect.Value) error {
+		v, isZero := field.ValueOf(stmt.Context, rv)
+		if isZero {
+			return field.Set(stmt.Context, rv, tenant)
+		}
+		if !sameTenant(v, tenant) {
+			return fmt.Errorf("%w: %s %v", ErrTenantMismatch, field.DBName, v)
+		}
+		return nil
+	}
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Struct:
+		return check(stmt.ReflectValue)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if err := check(reflect.Indirect(stmt.ReflectValue.Index(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// where 附加租户条件, 已有条件整体分组, 避免 OR 条件按优先级与租户条件结合.
+func (p *TenantPlugin) where(db *gorm.DB, column string, tenant interface{}) {
+	stmt := db.Statement
+	cond := scopeCondition{clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: tenant}}
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			c.Expression = clause.Where{Exprs: []clause.Expression{clause.And(where.Exprs...), cond}}
+			stmt.Clauses["WHERE"] = c
+			return
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{cond}})
+}
+
+func sameTenant(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantCtxKey struct{}
+
+type tenantItem struct {
+	ID       int64
+	TenantID int64
+	Name     string
+}
+
+func newTenantDB(t *testing.T) (*TenantPlugin, *gorm.DB, *fakeConnector) {
+	t.Helper()
+	p := NewTenantPlugin(TenantOptions{
+		Models: []interface{}{&tenantItem{}},
+		Tenant: func(ctx context.Context) (interface{}, bool) {
+			tenant := ctx.Value(tenantCtxKey{})
+			return tenant, tenant != nil
+		},
+	})
+	db, c := newFakeDB(t, p)
+	return p, db.WithContext(context.WithValue(context.Background(), tenantCtxKey{}, int64(7))), c
+}
+
+// assertExec 校验最后一条语句及参数.
+func assertExec(t *testing.T, c *fakeConnector, sql string, args ...interface{}) {
+	t.Helper()
+	exec := lastExec(t, c)
+	if got := normalizeSQL(exec.sql); got != sql {
+		t.Fatalf("sql:\ngot  %s\nwant %s", got, sql)
+	}
+	if !reflect.DeepEqual(exec.args, args) {
+		t.Fatalf("args: got %v, want %v", exec.args, args)
+	}
+}
+
+func TestTenantCreate(t *testing.T) {
+	_, db, c := newTenantDB(t)
+
+	item := &tenantItem{Name: "a"}
+	if err := db.Create(item).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "INSERT INTO tenant_items (tenant_id,name) VALUES (?,?)", int64(7), "a")
+	if item.TenantID != 7 {
+		t.Fatalf("tenant %d, want 7", item.TenantID)
+	}
+
+	rows := []map[string]interface{}{{"name": "a"}, {"name": "b"}}
+	if err := db.Table("tenant_items").Create(rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "INSERT INTO tenant_items (name,tenant_id) VALUES (?,?),(?,?)", "a", int64(7), "b", int64(7))
+
+	for _, dest := range []interface{}{
+		&tenantItem{TenantID: 8, Name: "a"},
+		[]*tenantItem{{Name: "a"}, {TenantID: 8, Name: "b"}},
+		[]map[string]interface{}{{"name": "a"}, {"name": "b", "tenant_id": 8}},
+	} {
+		if err := db.Table("tenant_items").Create(dest).Error; !errors.Is(err, ErrTenantMismatch) {
+			t.Fatalf("create %T: got %v, want ErrTenantMismatch", dest, err)
+		}
+	}
+	if execs := c.statements(); len(execs) > 0 {
+		t.Fatalf("mismatched create executed: %s", execs[0].sql)
+	}
+}
+
+func TestTenantUpsert(t *testing.T) {
+	_, db, c := newTenantDB(t)
+
+	tests := []struct {
+		name       string
+		onConflict clause.OnConflict
+		want       string
+		args       []interface{}
+	}{
+		{
+			"update all",
+			clause.OnConflict{UpdateAll: true},
+			"INSERT INTO tenant_items (tenant_id,name,id) VALUES (?,?,?) ON DUPLICATE KEY UPDATE name=IF(tenant_id = ?, VALUES(name), name)",
+			[]interface{}{int64(7), "a", int64(1), int64(7)},
+		},
+		{
+			"update columns",
+			clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"name", "tenant_id"})},
+			"INSERT INTO tenant_items (tenant_id,name,id) VALUES (?,?,?) ON DUPLICATE KEY UPDATE name=IF(tenant_id = ?, VALUES(name), name)",
+			[]interface{}{int64(7), "a", int64(1), int64(7)},
+		},
+		{
+			"tenant column only",
+			clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"tenant_id"})},
+			"INSERT INTO tenant_items (tenant_id,name,id) VALUES (?,?,?) ON DUPLICATE KEY UPDATE tenant_id=tenant_id",
+			[]interface{}{int64(7), "a", int64(1)},
+		},
+		{
+			"do nothing",
+			clause.OnConflict{DoNothing: true},
+			"INSERT INTO tenant_items (tenant_id,name,id) VALUES (?,?,?) ON DUPLICATE KEY UPDATE id=id",
+			[]interface{}{int64(7), "a", int64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.Clauses(tt.onConflict).Create(&tenantItem{ID: 1, Name: "a"}).Error; err != nil {
+				t.Fatal(err)
+			}
+			assertExec(t, c, tt.want, tt.args...)
+		})
+	}
+
+	// 绕过隔离时不附加保护.
+	p, db, c := newTenantDB(t)
+	ctx := p.Bypass(db.Statement.Context, "test")
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&tenantItem{ID: 1, TenantID: 8, Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sql := lastExec(t, c).sql; strings.Contains(sql, "IF(") {
+		t.Fatalf("bypassed upsert guarded: %s", sql)
+	}
+}
+
+func TestTenantQuery(t *testing.T) {
+	_, db, c := newTenantDB(t)
+
+	if err := db.Where("name = ?", "a").Or("name = ?", "b").Find(&[]tenantItem{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "SELECT * FROM tenant_items WHERE (name = ? OR name = ?) AND tenant_items.tenant_id = ?", "a", "b", int64(7))
+
+	if err := db.Table("tenant_items").Find(&[]map[string]interface{}{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "SELECT * FROM tenant_items WHERE tenant_items.tenant_id = ?", int64(7))
+
+	if err := db.Table("others").Find(&[]map[string]interface{}{}).Error; !errors.Is(err, ErrTenantUnknownTable) {
+		t.Fatalf("got %v, want ErrTenantUnknownTable", err)
+	}
+	if err := db.WithContext(context.Background()).Find(&[]tenantItem{}).Error; !errors.Is(err, ErrTenantMissing) {
+		t.Fatalf("got %v, want ErrTenantMissing", err)
+	}
+	if err := db.Raw("SELECT * FROM tenant_items").Scan(&[]tenantItem{}).Error; !errors.Is(err, ErrTenantRawSQL) {
+		t.Fatalf("got %v, want ErrTenantRawSQL", err)
+	}
+}
+
+func TestTenantUpdate(t *testing.T) {
+	_, db, c := newTenantDB(t)
+
+	if err := db.Model(&tenantItem{ID: 1}).Update("name", "b").Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "UPDATE tenant_items SET name=? WHERE tenant_items.tenant_id = ? AND id = ?", "b", int64(7), int64(1))
+
+	if err := db.Model(&tenantItem{ID: 1}).Update("tenant_id", 8).Error; !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("got %v, want ErrTenantMismatch", err)
+	}
+	if err := db.Save(&tenantItem{ID: 1, TenantID: 8, Name: "b"}).Error; !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("got %v, want ErrTenantMismatch", err)
+	}
+	if err := db.Model(&tenantItem{}).Update("name", "b").Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("got %v, want ErrMissingWhereClause", err)
+	}
+	if execs := c.statements(); len(execs) > 0 {
+		t.Fatalf("rejected update executed: %s", execs[0].sql)
+	}
+}
+
+func TestTenantDelete(t *testing.T) {
+	_, db, c := newTenantDB(t)
+
+	if err := db.Delete(&tenantItem{ID: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "DELETE FROM tenant_items WHERE tenant_items.tenant_id = ? AND tenant_items.id = ?", int64(7), int64(1))
+
+	if err := db.Table("tenant_items").Where("name = ?", "a").Delete(nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	assertExec(t, c, "DELETE FROM tenant_items WHERE name = ? AND tenant_items.tenant_id = ?", "a", int64(7))
+
+	if err := db.Delete(&tenantItem{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("got %v, want ErrMissingWhereClause", err)
+	}
+	if execs := c.statements(); len(execs) > 0 {
+		t.Fatalf("rejected delete executed: %s", execs[0].sql)
+	}
+}
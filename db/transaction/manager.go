@@ -6,7 +6,8 @@ import (
 )
 
 var (
-	ErrDBLookup = errors.New("matching database not found")
+	ErrDBLookup           = errors.New("matching database not found")
+	ErrUnsupportedManager = errors.New("manager not created by NewManager")
 )
 
 // NewManager 创建事务管理器.
@@ -92,6 +93,10 @@ func (m *manager) Transaction(ctx context.Context, callback func(context.Context
 		return callback(m.setTransContext(ctx, tc))
 	})
 	tc.End(err)
+	// 新开启的根事务结束时由根节点触发回调.
+	if ptc.isRoot() && ptc.db == nil {
+		ptc.End(err)
+	}
 	return err
 }
 
@@ -109,3 +114,35 @@ func (m *manager) OnCommitted(ctx context.Context, callback func(context.Context
 	tc.OnCommitted(func() { callback(m.cleanTransContext(ctx)) })
 	return true
 }
+
+// Detached 由调用方控制结束的根事务上下文.
+type Detached struct {
+	tc *transContext
+}
+
+// Detach 以已开启的事务 db 创建根事务上下文, 用于测试等需要跨越回调范围的场景.
+//
+// 事务的提交与回滚由调用方负责. 返回 context 中注册的 OnCommitted 回调不会自动触发,
+// 通过 Flush 手动触发. m 需由 NewManager 创建.
+func Detach(ctx context.Context, m Manager, db interface{}) (context.Context, *Detached, error) {
+	mm, ok := m.(*manager)
+	if !ok {
+		return nil, nil, ErrUnsupportedManager
+	}
+	tc := &transContext{db: db}
+	return mm.setTransContext(ctx, tc), &Detached{tc: tc}, nil
+}
+
+// Flush 触发已注册的 OnCommitted 回调并清空.
+//
+// 嵌套事务失败或 panic 时其中注册的回调不触发.
+func (d *Detached) Flush() {
+	d.tc.mut.Lock()
+	callbacks := d.tc.onCommittedCallbacks
+	d.tc.onCommittedCallbacks = nil
+	d.tc.mut.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
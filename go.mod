@@ -3,12 +3,14 @@ module github.com/tp-life/driver
 go 1.21.4
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/bytedance/sonic v1.10.2
 	github.com/go-errors/errors v1.5.1
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/gofiber/fiber/v2 v2.52.2
 	github.com/grpc-ecosystem/go-grpc-middleware/v2 v2.0.1
 	google.golang.org/grpc v1.60.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.5.2
 	gorm.io/gorm v1.25.5
 	gorm.io/plugin/dbresolver v1.5.0
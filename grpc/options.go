@@ -1,6 +1,10 @@
 package grpc
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,12 +26,13 @@ type Grpc struct {
 	Addr    string `id:"addr" json:"addr" default:":50051"`
 }
 
+// Parameters 连接参数, 为 0 的项使用 grpc 默认值(超时类为不限制).
 type Parameters struct {
-	IdleTimeout       time.Duration `id:"idle_timeout" json:"idle_timeout" desc:"Idle timeout for connections"`
-	MaxLifeTime       time.Duration `id:"max_life_time" json:"max_life_time" desc:"Max life time for connections"`
-	ForceCloseWait    time.Duration `id:"force_close_wait" json:"force_close_wait" desc:"Time to wait before force closing connections"`
-	KeepAliveInterval time.Duration `id:"keep_alive_interval" json:"keep_alive_interval" desc:"Interval to send keep alive messages"`
-	KeepAliveTimeout  time.Duration `id:"keep_alive_timeout" json:"keep_alive_timeout" desc:"Timeout for keep alive messages"`
+	IdleTimeout       time.Duration `id:"idle_timeout" json:"idle_timeout" default:"60s" desc:"Idle timeout for connections"`
+	MaxLifeTime       time.Duration `id:"max_life_time" json:"max_life_time" default:"2h" desc:"Max life time for connections"`
+	ForceCloseWait    time.Duration `id:"force_close_wait" json:"force_close_wait" default:"20s" desc:"Time to wait before force closing connections"`
+	KeepAliveInterval time.Duration `id:"keep_alive_interval" json:"keep_alive_interval" default:"60s" desc:"Interval to send keep alive messages"`
+	KeepAliveTimeout  time.Duration `id:"keep_alive_timeout" json:"keep_alive_timeout" default:"20s" desc:"Timeout for keep alive messages"`
 }
 
 type Auth struct {
@@ -95,3 +100,67 @@ func (o *Parameters) getGrpcKeepaliveParams() grpc.ServerOption {
 		},
 	)
 }
+
+// Validate 校验服务配置, 返回全部问题. Grpc、Parameters 为 nil 时使用默认配置, 不做校验.
+func (o *Options) Validate() error {
+	var errs []error
+	if o.Grpc != nil {
+		errs = append(errs, o.Grpc.validate()...)
+	}
+	if o.Parameters != nil {
+		errs = append(errs, o.Parameters.validate()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (o *Grpc) validate() []error {
+	var errs []error
+	switch o.Network {
+	case "tcp", "tcp4", "tcp6":
+		_, port, err := net.SplitHostPort(o.Addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("grpc.addr: %w", err))
+			break
+		}
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			errs = append(errs, fmt.Errorf("grpc.addr: port must be between 1 and 65535, got %q", port))
+		}
+	case "unix", "unixpacket":
+		if o.Addr == "" {
+			errs = append(errs, errors.New("grpc.addr: required"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("grpc.network: unsupported network %q", o.Network))
+	}
+	return errs
+}
+
+func (o *Parameters) validate() []error {
+	var errs []error
+	for _, d := range []struct {
+		id    string
+		value time.Duration
+	}{
+		{"idle_timeout", o.IdleTimeout},
+		{"max_life_time", o.MaxLifeTime},
+		{"force_close_wait", o.ForceCloseWait},
+		{"keep_alive_interval", o.KeepAliveInterval},
+		{"keep_alive_timeout", o.KeepAliveTimeout},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("parameters.%s: must not be negative, got %s", d.id, d.value))
+		}
+	}
+	// 0 表示使用 grpc 默认值或不限制, 仅校验已设置的值之间的关系.
+	// grpc 将小于 1s 的心跳间隔调整为 1s
+	if o.KeepAliveInterval > 0 && o.KeepAliveInterval < time.Second {
+		errs = append(errs, fmt.Errorf("parameters.keep_alive_interval: must be at least 1s, got %s", o.KeepAliveInterval))
+	}
+	if o.KeepAliveTimeout > 0 && o.KeepAliveInterval > 0 && o.KeepAliveTimeout >= o.KeepAliveInterval {
+		errs = append(errs, fmt.Errorf("parameters.keep_alive_timeout: must be less than keep_alive_interval (%s), got %s", o.KeepAliveInterval, o.KeepAliveTimeout))
+	}
+	if o.IdleTimeout > 0 && o.MaxLifeTime > 0 && o.IdleTimeout > o.MaxLifeTime {
+		errs = append(errs, fmt.Errorf("parameters.idle_timeout: must not exceed max_life_time (%s), got %s", o.MaxLifeTime, o.IdleTimeout))
+	}
+	return errs
+}
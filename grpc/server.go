@@ -25,12 +25,24 @@ type RPCServer struct {
 	network string
 }
 
-// New grpc server
+// New grpc server, 不校验配置, 需要校验时使用 NewE.
 func New(opt ...*Options) *RPCServer {
 	option := DefaultOptions()
+	option.merge(opt)
+	return newServer(option)
+}
 
+// NewE 校验合并后的配置并创建 grpc server, 配置无效时返回全部问题.
+func NewE(opt ...*Options) (*RPCServer, error) {
+	option := DefaultOptions()
 	option.merge(opt)
+	if err := option.Validate(); err != nil {
+		return nil, err
+	}
+	return newServer(option), nil
+}
 
+func newServer(option *Options) *RPCServer {
 	keepParams := option.Parameters.getGrpcKeepaliveParams()
 
 	unaryServerInterceptors := make([]grpc.UnaryServerInterceptor, 0)
@@ -45,12 +45,16 @@ func NewEngine(opts ...RuntimeOption) *Engine {
 	return &Engine{App: app}
 }
 
-func (e *Engine) Serve(opt Option) {
+// Serve 校验配置并启动服务, 配置无效时返回错误.
+func (e *Engine) Serve(opt Option) error {
+	if err := opt.Validate(); err != nil {
+		return fmt.Errorf("http server option error: %w", err)
+	}
 	err := e.App.Listen(":" + strconv.Itoa(int(opt.Port)))
 	if err != nil {
 		panic(fmt.Sprintf("%d: http server start error: %+v", opt.Port, err))
 	}
-
+	return nil
 }
 
 func (e *Engine) Quit() {
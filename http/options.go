@@ -1,6 +1,7 @@
 package http
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,6 +13,14 @@ type Option struct {
 	Port int `json:"port"`
 }
 
+// Validate 校验服务配置.
+func (o Option) Validate() error {
+	if o.Port <= 0 || o.Port > 65535 {
+		return fmt.Errorf("port: must be between 1 and 65535, got %d", o.Port)
+	}
+	return nil
+}
+
 type RuntimeOption struct {
 	Pprof       bool
 	IsRelease   bool